@@ -0,0 +1,220 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "errors"
+import "context"
+import "sync"
+import "sync/atomic"
+
+// FullPolicy controls what an AsyncWriter does when its buffer is full.
+type FullPolicy int
+
+const (
+	BlockWhenFull = FullPolicy(iota) // Wait for room in the buffer.
+	DropWhenFull                     // Drop the write.
+)
+
+// AsyncWriter is an io.Writer that queues writes and passes them on to another writer from a dedicated goroutine,
+// so slow writers do not hold up the logging code. Writes are passed on in order, and each write is passed on as
+// a single write to the wrapped writer.
+//
+// Errors from the wrapped writer are ignored, there is no one to report them to.
+type AsyncWriter struct {
+	w      io.Writer
+	policy FullPolicy
+	c      chan asyncMsg
+	done   chan struct{}
+
+	stopped  chan struct{} // Closed by stop, to wake up anything waiting for room in c.
+	stopOnce sync.Once
+	lock     sync.RWMutex // Write lock is only held to close c, read lock is held while sending to it.
+	closed   bool
+	dropped  atomic.Uint64
+}
+
+// asyncMsg is either data to write or a flush request.
+type asyncMsg struct {
+	p       []byte
+	flushed chan struct{}
+}
+
+// NewAsyncWriter creates an AsyncWriter that buffers up to size writes for w. policy controls what happens to
+// writes when the buffer is full.
+func NewAsyncWriter(w io.Writer, size int, policy FullPolicy) *AsyncWriter {
+	aw := &AsyncWriter{
+		w:       w,
+		policy:  policy,
+		c:       make(chan asyncMsg, size),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(aw.done)
+
+		for msg := range aw.c {
+			if msg.flushed != nil {
+				close(msg.flushed)
+				continue
+			}
+			aw.w.Write(msg.p)
+		}
+	}()
+	return aw
+}
+
+// NewAsyncWriterContext is like NewAsyncWriter, but when ctx is done the writer stops accepting writes and
+// drains what is already queued, as if Close had been called. Use Wait to find out when it is done.
+func NewAsyncWriterContext(ctx context.Context, w io.Writer, size int, policy FullPolicy) *AsyncWriter {
+	aw := NewAsyncWriter(w, size, policy)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			aw.stop()
+		case <-aw.done:
+		}
+	}()
+	return aw
+}
+
+// Write queues a copy of p. The returned error is only ever non-nil if the writer is closed, dropped writes are
+// reported as successful (see Dropped). A write waiting for room in the buffer gives up with os.ErrClosed if the
+// writer is stopped.
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	// The log package reuses its buffer, so the data must be copied.
+	msg := asyncMsg{p: append([]byte(nil), p...)}
+	if aw.policy == DropWhenFull {
+		aw.lock.RLock()
+		defer aw.lock.RUnlock()
+
+		if aw.closed {
+			return 0, os.ErrClosed
+		}
+		select {
+		case aw.c <- msg:
+		default:
+			aw.dropped.Add(1)
+		}
+		return len(p), nil
+	}
+
+	err := aw.send(msg, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send queues msg, waiting for room in the buffer until the writer is stopped or cancel is closed (cancel may
+// be nil). It returns os.ErrClosed if the writer was stopped, or errCanceled if cancel was closed first.
+func (aw *AsyncWriter) send(msg asyncMsg, cancel <-chan struct{}) error {
+	aw.lock.RLock()
+	defer aw.lock.RUnlock()
+
+	if aw.closed {
+		return os.ErrClosed
+	}
+	select {
+	case aw.c <- msg:
+		return nil
+	case <-aw.stopped:
+		return os.ErrClosed
+	case <-cancel:
+		return errCanceled
+	}
+}
+
+// errCanceled is returned by AsyncWriter.send when it was canceled.
+var errCanceled = errors.New("sessionlogger: canceled")
+
+// Flush blocks until every write queued before the call has been passed on to the wrapped writer.
+func (aw *AsyncWriter) Flush() error {
+	flushed := make(chan struct{})
+	if aw.send(asyncMsg{flushed: flushed}, nil) != nil {
+		// Stopped, Close waits for the rest.
+		return nil
+	}
+	<-flushed
+	return nil
+}
+
+// Wait blocks until every write queued before the call has been passed on to the wrapped writer, or until ctx is
+// done, in which case the error from ctx is returned. If the writer has stopped (from Close or the context given
+// to NewAsyncWriterContext) it waits until everything has been written. Use a context with a deadline to keep a
+// slow writer from holding up shutdown.
+func (aw *AsyncWriter) Wait(ctx context.Context) error {
+	flushed := make(chan struct{})
+	switch aw.send(asyncMsg{flushed: flushed}, ctx.Done()) {
+	case os.ErrClosed:
+		select {
+		case <-aw.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case errCanceled:
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of writes dropped because the buffer was full.
+func (aw *AsyncWriter) Dropped() uint64 {
+	return aw.dropped.Load()
+}
+
+// Close stops accepting writes and waits for everything already queued to be written. It does not close the
+// wrapped writer.
+func (aw *AsyncWriter) Close() error {
+	aw.stop()
+	<-aw.done
+	return nil
+}
+
+// stop stops accepting writes, without waiting for the queue to drain. Anything waiting for room in the buffer
+// is woken up first, so the lock is never held for long.
+func (aw *AsyncWriter) stop() {
+	aw.stopOnce.Do(func() { close(aw.stopped) })
+
+	aw.lock.Lock()
+	defer aw.lock.Unlock()
+
+	if !aw.closed {
+		aw.closed = true
+		close(aw.c)
+	}
+}
+
+func (aw *AsyncWriter) unwrap() []io.Writer {
+	return []io.Writer{aw.w}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "fmt"
+import "bytes"
+import "time"
+import "errors"
+import "context"
+import "testing"
+
+// gateWriter blocks every write until open is closed, and reports on started when a write begins.
+type gateWriter struct {
+	bytes.Buffer
+	started chan struct{}
+	open    chan struct{}
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{started: make(chan struct{}, 100), open: make(chan struct{})}
+}
+
+func (gw *gateWriter) Write(p []byte) (int, error) {
+	gw.started <- struct{}{}
+	<-gw.open
+	return gw.Buffer.Write(p)
+}
+
+func TestAsyncWriterOrder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	aw := NewAsyncWriter(buf, 4, BlockWhenFull)
+
+	want := ""
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(aw, "%d\n", i)
+		want += fmt.Sprintf("%d\n", i)
+	}
+
+	// Close must wait for the queue to drain, no Flush needed.
+	aw.Close()
+	if buf.String() != want {
+		t.Errorf("writes out of order or lost:\n%q", buf.String())
+	}
+
+	if _, err := aw.Write([]byte("late\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("write after Close returned %v", err)
+	}
+	if err := aw.Flush(); err != nil {
+		t.Errorf("Flush after Close returned %v", err)
+	}
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	buf := &bytes.Buffer{}
+	aw := NewAsyncWriter(buf, 16, BlockWhenFull)
+	defer aw.Close()
+
+	aw.Write([]byte("a\n"))
+	aw.Write([]byte("b\n"))
+	aw.Flush()
+	if buf.String() != "a\nb\n" {
+		t.Errorf("after Flush: %q", buf.String())
+	}
+}
+
+func TestAsyncWriterDropWhenFull(t *testing.T) {
+	gw := newGateWriter()
+	aw := NewAsyncWriter(gw, 1, DropWhenFull)
+
+	aw.Write([]byte("1\n"))
+	<-gw.started // The goroutine is now stuck writing "1", so the buffer is empty.
+
+	aw.Write([]byte("2\n")) // Fills the buffer.
+	aw.Write([]byte("3\n"))
+	n, err := aw.Write([]byte("4\n"))
+	if n != 2 || err != nil {
+		t.Errorf("dropped write returned %v, %v", n, err)
+	}
+
+	close(gw.open)
+	aw.Close()
+	if gw.String() != "1\n2\n" {
+		t.Errorf("output = %q", gw.String())
+	}
+	if aw.Dropped() != 2 {
+		t.Errorf("Dropped() = %v, want 2", aw.Dropped())
+	}
+}
+
+func TestAsyncWriterContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gw := newGateWriter()
+	aw := NewAsyncWriterContext(ctx, gw, 4, BlockWhenFull)
+
+	aw.Write([]byte("1\n"))
+	<-gw.started // Stuck writing "1", with more queued behind it.
+	aw.Write([]byte("2\n"))
+	aw.Write([]byte("3\n"))
+	cancel()
+
+	// Writing to find out would block once the buffer is full, so look directly.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		aw.lock.RLock()
+		closed := aw.closed
+		aw.lock.RUnlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("still accepting writes 5s after cancel")
+		}
+	}
+	if _, err := aw.Write([]byte("late\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("write after cancel returned %v", err)
+	}
+
+	// The drain is stuck, so Wait gives up at the deadline.
+	short, done := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer done()
+	if err := aw.Wait(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait on a stuck writer returned %v", err)
+	}
+
+	close(gw.open)
+	if err := aw.Wait(context.Background()); err != nil {
+		t.Errorf("Wait returned %v", err)
+	}
+	if gw.String() != "1\n2\n3\n" {
+		t.Errorf("output = %q", gw.String())
+	}
+}
+
+func TestAsyncWriterContextCancelFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	gw := newGateWriter()
+	aw := NewAsyncWriterContext(ctx, gw, 1, BlockWhenFull)
+
+	aw.Write([]byte("1\n"))
+	<-gw.started            // Stuck writing "1".
+	aw.Write([]byte("2\n")) // Fills the buffer.
+	blocked := make(chan error)
+	go func() {
+		_, err := aw.Write([]byte("3\n"))
+		blocked <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // Give the write time to block.
+	cancel()
+
+	// The blocked write gives up, and later ones fail right away.
+	select {
+	case err := <-blocked:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Errorf("blocked write returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write still blocked 5s after cancel")
+	}
+	if _, err := aw.Write([]byte("late\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("write after cancel returned %v", err)
+	}
+
+	// Wait keeps to its deadline even though the writer is stuck.
+	short, done := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer done()
+	start := time.Now()
+	if err := aw.Wait(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait on a stuck writer returned %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Wait took %v with a 10ms deadline", d)
+	}
+
+	close(gw.open)
+	if err := aw.Close(); err != nil {
+		t.Errorf("Close returned %v", err)
+	}
+	if gw.String() != "1\n2\n" {
+		t.Errorf("output = %q", gw.String())
+	}
+}
+
+func TestAsyncWriterWaitDeadline(t *testing.T) {
+	gw := newGateWriter()
+	aw := NewAsyncWriter(gw, 4, BlockWhenFull)
+
+	aw.Write([]byte("slow\n"))
+	<-gw.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := aw.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait returned %v", err)
+	}
+
+	close(gw.open)
+	if err := aw.Wait(context.Background()); err != nil {
+		t.Errorf("Wait returned %v", err)
+	}
+	if gw.String() != "slow\n" {
+		t.Errorf("output = %q", gw.String())
+	}
+	aw.Close()
+}
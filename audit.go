@@ -0,0 +1,104 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "fmt"
+import "log"
+
+// AuditLogger is a session logger for events that must not be lost, such as those needed for compliance. Every
+// level writes to the single writer given when it is created, skipping the writers of the config and everything
+// that may drop or change messages (tees, RateLimit, Dedup, Filter, MaxLineBytes, and Colorize). Sequenced and
+// SanitizeControlChars still apply, and audit messages are included in Counts and Stats. After each message is
+// written the writer is synced (if it has a Sync or Flush method, as files do), so the message is on stable
+// storage before the method writing it returns. All levels are enabled, no matter what the config says, and no
+// session start message is written.
+//
+// Audit and Auditf report errors from writing or syncing, the methods of the embedded Logger ignore them as
+// usual. Everything else from the config (ID generation, prefixes, flags, JSON output) applies as normal.
+type AuditLogger struct {
+	*Logger
+}
+
+// NewAuditLogger creates an AuditLogger for endpoint that writes to w. See AuditLogger.
+func (lc *Config) NewAuditLogger(endpoint string, w io.Writer) *AuditLogger {
+	al, err := lc.TryNewAuditLogger(endpoint, w)
+	if err != nil {
+		panic(err)
+	}
+	return al
+}
+
+// TryNewAuditLogger is NewAuditLogger, but if generating the session ID fails (including if IDGenerator panics)
+// an error is returned instead of panicking.
+func (lc *Config) TryNewAuditLogger(endpoint string, w io.Writer) (*AuditLogger, error) {
+	lc.lock.RLock()
+	id, err := lc.tryNewID()
+	if err != nil {
+		lc.lock.RUnlock()
+		return nil, err
+	}
+	sw := &syncingWriter{w: w}
+	l := lc.newLogger(endpoint, id, false)
+	for lvl := Debug; lvl <= Err; lvl++ {
+		ll := *l.field(lvl)
+		l.out[lvl] = replaceDestination(l.out[lvl], lc.auditDestination(lvl, sw))
+		l.disabled[lvl] = false
+		*l.field(lvl) = log.New(l.out[lvl], ll.Prefix(), ll.Flags())
+		l.apply(lvl)
+	}
+	reg := lc.Register
+	lc.lock.RUnlock()
+
+	if reg {
+		register(lc, l)
+	}
+	return &AuditLogger{l}, nil
+}
+
+// Audit writes msg to the info log, and returns any error from writing or syncing it.
+func (al *AuditLogger) Audit(msg string) error {
+	return al.output(Info, 2, msg)
+}
+
+// Auditf is Audit with fmt.Sprintf style formatting.
+func (al *AuditLogger) Auditf(format string, v ...any) error {
+	return al.output(Info, 2, fmt.Sprintf(format, v...))
+}
+
+// syncingWriter syncs the writer it wraps after every write.
+type syncingWriter struct {
+	w io.Writer
+}
+
+func (sw *syncingWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, syncWriters(sw.w)
+}
+
+func (sw *syncingWriter) unwrap() []io.Writer {
+	return []io.Writer{sw.w}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "fmt"
+import "time"
+import "errors"
+import "strings"
+import "testing"
+
+// syncCounter is a fake file that records how many writes were made before each sync.
+type syncCounter struct {
+	CaptureWriter
+	writes int
+	synced []int
+	err    error
+}
+
+func (sc *syncCounter) Write(p []byte) (int, error) {
+	sc.writes++
+	return sc.CaptureWriter.Write(p)
+}
+
+func (sc *syncCounter) Sync() error {
+	sc.synced = append(sc.synced, sc.writes)
+	return sc.err
+}
+
+func TestAuditLogger(t *testing.T) {
+	drop := func([]byte) []byte { return nil }
+	lc := (&Config{}).Flags(NoFlags).Disable(Info).RateLimit(Info, 1).Dedup(time.Hour).Filter(Info, drop)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, io.Discard)
+	}
+
+	sc := &syncCounter{}
+	al := lc.NewAuditLogger("billing", sc)
+	for i := 0; i < 3; i++ {
+		if err := al.Auditf("charged card %d", 42); err != nil {
+			t.Fatal(err)
+		}
+	}
+	al.Err("refund failed")
+
+	want := []string{
+		"INFO@billing:" + al.ID + ": charged card 42",
+		"INFO@billing:" + al.ID + ": charged card 42",
+		"INFO@billing:" + al.ID + ": charged card 42",
+		" ERR@billing:" + al.ID + ": refund failed",
+	}
+	if got := sc.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if fmt.Sprint(sc.synced) != "[1 2 3 4]" {
+		t.Errorf("synced after writes %v, want after every write", sc.synced)
+	}
+	if al.ID == "" || al.IsMaster() {
+		t.Errorf("audit logger is not a session logger: %q", al.ID)
+	}
+}
+
+func TestAuditLoggerSyncError(t *testing.T) {
+	failed := errors.New("disk on fire")
+	al := (&Config{}).NewAuditLogger("ep", &syncCounter{err: failed})
+
+	if err := al.Audit("important"); !errors.Is(err, failed) {
+		t.Errorf("Audit returned %v", err)
+	}
+}
+
+func TestAuditLoggerChain(t *testing.T) {
+	lc := (&Config{}).Flags(NoFlags).Sequenced(true).SanitizeControlChars(true).MaxLineBytes(10)
+	lc.Colorize = true
+	lc.Writer(Info, io.Discard)
+
+	sc := &syncCounter{}
+	al := lc.NewAuditLogger("ep", sc)
+	if err := al.Audit("bell\athen a long line"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "#000001 INFO@ep:" + al.ID + ": bell\\x07then a long line"
+	if got := sc.Lines(); len(got) != 1 || got[0] != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if info, _, _ := lc.Counts(); info != 1 {
+		t.Errorf("counted %d info messages, want 1", info)
+	}
+}
+
+func TestTryNewAuditLogger(t *testing.T) {
+	lc := &Config{IDGenerator: func() string { panic("out of IDs") }}
+
+	al, err := lc.TryNewAuditLogger("ep", &syncCounter{})
+	if al != nil || err == nil || !strings.Contains(err.Error(), "out of IDs") {
+		t.Errorf("TryNewAuditLogger = %v, %v", al, err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("NewAuditLogger did not panic")
+			}
+		}()
+		lc.NewAuditLogger("ep", &syncCounter{})
+	}()
+
+	// The lock was released, so the config can still be changed.
+	done := make(chan struct{})
+	go func() {
+		lc.Disable(Debug)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config still locked after a failed audit logger")
+	}
+}
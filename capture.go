@@ -0,0 +1,89 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "sync"
+import "bytes"
+import "strings"
+
+// CaptureWriter is an io.Writer that keeps everything written to it in memory, for checking log output in tests.
+// It is safe for concurrent use.
+//
+//	l, cw := sessionlogger.NewTestLogger()
+//	DoTheThing(l)
+//	if !cw.Contains("the thing was done") {
+//		t.Errorf("expected a log message, got: %q", cw.Lines())
+//	}
+type CaptureWriter struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+// Write appends p to the captured data.
+func (cw *CaptureWriter) Write(p []byte) (int, error) {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+
+	return cw.buf.Write(p)
+}
+
+// String returns everything captured so far.
+func (cw *CaptureWriter) String() string {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+
+	return cw.buf.String()
+}
+
+// Lines returns the captured data split into lines, without the line endings. A final incomplete line is
+// included.
+func (cw *CaptureWriter) Lines() []string {
+	s := strings.TrimSuffix(cw.String(), "\n")
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+// Contains reports if substr appears anywhere in the captured data.
+func (cw *CaptureWriter) Contains(substr string) bool {
+	return strings.Contains(cw.String(), substr)
+}
+
+// Reset throws away everything captured so far.
+func (cw *CaptureWriter) Reset() {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+
+	cw.buf.Reset()
+}
+
+// NewTestLogger creates a master logger that writes every level to a new CaptureWriter.
+func NewTestLogger() (*Logger, *CaptureWriter) {
+	cw := &CaptureWriter{}
+	lc := &Config{}
+	for l := Debug; l <= Err; l++ {
+		lc.Writers[l] = cw
+	}
+	return lc.NewMasterLogger(), cw
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "sync"
+import "testing"
+
+func TestCaptureWriterConcurrent(t *testing.T) {
+	l, cw := NewTestLogger()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				l.Warnf("worker %d message %d", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(cw.Lines()); n != 200 {
+		t.Errorf("captured %d lines, want 200", n)
+	}
+	for i := 0; i < 10; i++ {
+		if !cw.Contains(fmt.Sprintf("worker %d message 19\n", i)) {
+			t.Errorf("missing the last message from worker %d", i)
+		}
+	}
+}
+
+func TestCaptureWriterReset(t *testing.T) {
+	l, cw := NewTestLogger()
+	if lines := cw.Lines(); len(lines) != 0 {
+		t.Fatalf("new capture has lines %q", lines)
+	}
+
+	l.Err("boom")
+	if !cw.Contains(" ERR: ") || !cw.Contains("boom") {
+		t.Errorf("captured %q", cw.String())
+	}
+	cw.Reset()
+	if cw.String() != "" || cw.Contains("boom") {
+		t.Errorf("Reset left %q", cw.String())
+	}
+}
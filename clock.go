@@ -0,0 +1,93 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "log"
+import "time"
+import "runtime"
+import "strconv"
+
+// now returns the time from the clock of the config the logger was created from, or the system clock.
+func (l *Logger) now() time.Time {
+	if l.clock != nil {
+		return l.clock()
+	}
+	return now()
+}
+
+// clockHeader formats the date, time, and file the same way the log package does, for loggers that have a
+// Clock. The log.Loggers of such loggers have no flags, so this is the only place the header is written.
+// calldepth is used like the argument to log.Logger.Output, counting from the caller of clockHeader.
+func (l *Logger) clockHeader(calldepth int) string {
+	file, line := "", 0
+	if l.flags&(log.Lshortfile|log.Llongfile) != 0 {
+		var ok bool
+		_, file, line, ok = runtime.Caller(calldepth)
+		if !ok {
+			file, line = "???", 0
+		}
+	}
+	return l.clockHeaderAt(file, line)
+}
+
+// clockHeaderAt is clockHeader for a caller that is already known.
+func (l *Logger) clockHeaderAt(file string, line int) string {
+	buf := []byte{}
+	if l.flags&(log.Ldate|log.Ltime|log.Lmicroseconds) != 0 {
+		t := l.clock()
+		if l.flags&log.LUTC != 0 {
+			t = t.UTC()
+		}
+		if l.flags&log.Ldate != 0 {
+			buf = t.AppendFormat(buf, "2006/01/02 ")
+		}
+		if l.flags&(log.Ltime|log.Lmicroseconds) != 0 {
+			buf = t.AppendFormat(buf, "15:04:05")
+			if l.flags&log.Lmicroseconds != 0 {
+				buf = t.AppendFormat(buf, ".000000")
+			}
+			buf = append(buf, ' ')
+		}
+	}
+
+	if l.flags&(log.Lshortfile|log.Llongfile) != 0 {
+		buf = appendCaller(buf, l.flags, file, line)
+	}
+	return string(buf)
+}
+
+// appendCaller appends "file:line: " to buf, shortening the file name if the flags include log.Lshortfile.
+func appendCaller(buf []byte, flags int, file string, line int) []byte {
+	if flags&log.Lshortfile != 0 {
+		for i := len(file) - 1; i > 0; i-- {
+			if file[i] == '/' {
+				file = file[i+1:]
+				break
+			}
+		}
+	}
+	buf = append(buf, file...)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(line), 10)
+	return append(buf, ": "...)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "log"
+import "time"
+import "bytes"
+import "strconv"
+import "strings"
+import "testing"
+
+func TestClock(t *testing.T) {
+	clock := func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 890123000, time.UTC) }
+
+	cases := []struct {
+		flags int
+		want  string
+	}{
+		{log.Ldate | log.Ltime, "INFO@ep:abc: 2022/03/04 05:06:07 hello\n"},
+		{log.Ltime | log.Lmicroseconds, "INFO@ep:abc: 05:06:07.890123 hello\n"},
+		{log.Ldate | log.Lshortfile, "INFO@ep:abc: 2022/03/04 clock_test.go:LINE: hello\n"},
+		{NoFlags, "INFO@ep:abc: hello\n"},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		l := (&Config{Clock: clock}).Flags(c.flags).LogSessionStart(false).Writer(Info, buf).
+			NewSessionLoggerWithID("ep", "abc")
+
+		l.Info("hello")
+		want := strings.Replace(c.want, "LINE", strconv.Itoa(line()-1), 1)
+		if buf.String() != want {
+			t.Errorf("flags %b: output %q, want %q", c.flags, buf.String(), want)
+		}
+	}
+}
+
+func TestClockJSON(t *testing.T) {
+	zone := time.FixedZone("test", 2*60*60)
+	clock := func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, zone) }
+
+	buf := &bytes.Buffer{}
+	lc := (&Config{Clock: clock}).JSON(true).Flags(log.LUTC).LogSessionStart(false).Writer(Info, buf)
+	lc.NewSessionLoggerWithID("ep", "abc").Info("hello")
+
+	entries, err := ParseEntries(buf)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("parsed %v, %v", entries, err)
+	}
+	if entries[0].Time != "2022-03-04T03:06:07Z" {
+		t.Errorf("time %q", entries[0].Time)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+
+import "golang.org/x/term"
+
+// ANSI escape codes for each level token.
+var levelColors = [4]string{
+	"\x1b[36m", // Debug: cyan
+	"\x1b[2m",  // Info: dim
+	"\x1b[33m", // Warn: yellow
+	"\x1b[31m", // Err: red
+}
+
+const colorReset = "\x1b[0m"
+
+// isTerminal reports if colors should be used for w. It is a variable so it can be swapped out when testing.
+var isTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// colorize wraps every terminal found in w so the level token is colored. Other writers are left alone, so a
+// file that is written along with the console stays plain.
+func colorize(w io.Writer, l logLevel, token string) io.Writer {
+	if mw, ok := w.(*multiWriter); ok {
+		writers := make([]io.Writer, len(mw.writers))
+		for i, w := range mw.writers {
+			writers[i] = colorize(w, l, token)
+		}
+		return &multiWriter{writers}
+	}
+	if isTerminal(w) {
+		return &colorWriter{w: w, level: l, token: token}
+	}
+	return w
+}
+
+// colorWriter colors the level token at the start of each message.
+type colorWriter struct {
+	w     io.Writer
+	level logLevel
+	token string
+}
+
+func (cw *colorWriter) Write(p []byte) (int, error) {
+	lead := seqLen(p)
+	tok := cw.token
+	rest := p[lead:]
+	if len(rest) < len(tok) || string(rest[:len(tok)]) != tok {
+		return cw.w.Write(p)
+	}
+
+	color := levelColors[cw.level]
+	buf := make([]byte, 0, len(p)+len(color)+len(colorReset))
+	buf = append(buf, p[:lead]...)
+	buf = append(buf, color...)
+	buf = append(buf, tok...)
+	buf = append(buf, colorReset...)
+	buf = append(buf, rest[len(tok):]...)
+
+	_, err := cw.w.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (cw *colorWriter) unwrap() []io.Writer {
+	return []io.Writer{cw.w}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "bytes"
+import "testing"
+
+func TestColor(t *testing.T) {
+	tty, plain := &bytes.Buffer{}, &bytes.Buffer{}
+
+	old := isTerminal
+	isTerminal = func(w io.Writer) bool { return w == tty }
+	defer func() { isTerminal = old }()
+
+	lc := (&Config{}).Color(true).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, tty, plain)
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+	l.Debug("d")
+	l.Info("i")
+	l.Warn("w")
+	l.Err("e")
+
+	want := "\x1b[36mDBUG\x1b[0m@ep:abc: d\n" +
+		"\x1b[2mINFO\x1b[0m@ep:abc: i\n" +
+		"\x1b[33mWARN\x1b[0m@ep:abc: w\n" +
+		"\x1b[31m ERR\x1b[0m@ep:abc: e\n"
+	if tty.String() != want {
+		t.Errorf("terminal got %q, want %q", tty.String(), want)
+	}
+	if want := "DBUG@ep:abc: d\nINFO@ep:abc: i\nWARN@ep:abc: w\n ERR@ep:abc: e\n"; plain.String() != want {
+		t.Errorf("plain writer got %q, want %q", plain.String(), want)
+	}
+}
+
+func TestColorOffForJSON(t *testing.T) {
+	tty := &bytes.Buffer{}
+
+	old := isTerminal
+	isTerminal = func(io.Writer) bool { return true }
+	defer func() { isTerminal = old }()
+
+	(&Config{}).Color(true).JSON(true).Writer(Info, tty).LogSessionStart(false).NewMasterLogger().Info("x")
+	if bytes.Contains(tty.Bytes(), []byte("\x1b[")) {
+		t.Errorf("JSON output was colored: %q", tty.String())
+	}
+}
@@ -24,49 +24,559 @@ package sessionlogger
 
 import "os"
 import "io"
+import "log"
+import "bytes"
 import "io/ioutil"
+import "sync"
+import "time"
+import "sync/atomic"
 
 type logLevel int
 
+// Level is the type of the level constants, for code outside this package that needs to name it, such as a
+// Formatter.
+type Level = logLevel
+
 // Logger levels for use with the config builder functions.
+//
+// Debug was added before the other levels, which changed the numbers of Info, Warn, and Err (they used to start at
+// 0). Always use the constants rather than their values, including as indexes into Writers and Disabled.
 const (
-	Info = logLevel(iota)
+	Debug = logLevel(iota)
+	Info
 	Warn
 	Err
 )
 
-// LoggerConfig contains the configuration for the current logger. You can either fill it out manually,
+// DefaultFlags are the log package flags used when the config does not specify any.
+const DefaultFlags = log.Ldate | log.Ltime | log.Lshortfile
+
+// NoFlags may be used as the value of Config.LogFlags to turn off all the log package flags, since 0 means
+// "use the default".
+const NoFlags = -1
+
+// Config contains the configuration for the current logger. You can either fill it out manually,
 // or use the provided helper functions. The zero value is a valid config that writes log messages to
 // Stdout and Stderr and has all log levels enabled.
 //
 // Note that changes to the config will not effect loggers created before the changes were made.
+//
+// The builder methods and the logger constructors are safe to call concurrently, so a shared config such as
+// DefaultConfig may be modified while other goroutines are creating loggers from it. Setting the fields directly
+// is not synchronized, do that before the config is shared or use the builder methods instead.
 type Config struct {
-	Disabled [3]bool      // Info, Warn, Err
-	Writers  [3]io.Writer // If nil, use the default for this level.
+	Disabled [4]bool      // Debug, Info, Warn, Err
+	Writers  [4]io.Writer // If nil, use the default for this level.
+	LogFlags int          // Flags for the log package. If 0, DefaultFlags is used. Set to NoFlags for no flags.
+	IDLength int          // Length of session IDs, see IDLen. If 0, IDs come from the shared shortid based generator.
+
+	// IDGenerator, if not nil, is called to get the ID for each new session logger instead of using the
+	// built in generators. Useful for embedding host names or trace IDs. It must be safe for concurrent use.
+	IDGenerator func() string
+
+	// If true, session loggers created from this config are added to the registry so they can be found with
+	// LoggerByID and ForEachLogger. Registered loggers are kept alive until Release is called on them, so this
+	// will leak memory if you forget to do that.
+	Register bool
+
+	// If true, each message is written as a JSON object on a single line. See JSON for details.
+	JSONOutput bool
+
+	// Formatter, if not nil, lays out every message instead of the normal text format or JSON. See Format.
+	Formatter Formatter
+
+	// Level tokens that start the prefix of each level. If empty, the default for that level ("INFO" and so on) is
+	// used. Not used in JSON mode.
+	Prefixes [4]string
+
+	// If true, session loggers do not write an empty message to the info level when they are created.
+	NoSessionStart bool
+
+	// If true, Logger.Recover and Logger.RecoverHTTP panic again after logging the panic.
+	Repanic bool
+
+	// If true, Logger.ErrWithStacks adds a dump of the stacks of all goroutines to the message. This is off by
+	// default because the dumps are expensive and large.
+	StackDumps bool
+
+	// If true, level tokens written to a terminal are colored. See Color for details.
+	Colorize bool
+
+	// Clock, if not nil, is used to get the time written in messages instead of the system clock, for tests that
+	// check the exact output. The time and file are then written by the methods of Logger instead of by the log
+	// package, so messages written with the log.Loggers directly (l.I.Printf and friends) have neither, and the
+	// log.Lmsgprefix flag is ignored. Logger.Timer uses the clock too.
+	Clock func() time.Time
+
+	lock     sync.RWMutex
+	counts   [4]atomic.Uint64
+	dropped  atomic.Uint64 // Messages dropped by RateLimit or Dedup.
+	failed   atomic.Uint64 // Messages that could not be written.
+	limits   [4]*rateLimit
+	tees     [4][]io.Writer
+	filters  [4][]func(msg []byte) []byte
+	maxLine  int
+	sanitize bool
+	dedups   [4]*dedup
+	seq      bool
+	eachLine bool
+	format   *prefixFormat
+	tagged   map[string]io.Writer
+	seqN     atomic.Uint64
+	live     map[*Logger]struct{} // Registered loggers, guarded by registryLock.
+	groups   sync.RWMutex         // Held for writing while a group is written, see groupedWriter.
 }
 
+// LoggerConfig is the old name of Config.
+//
+// Deprecated: Use Config.
+type LoggerConfig = Config
+
 // Disable is a convenience method that makes a specific log level as disabled. Will panic if the level is invalid.
 func (lc *Config) Disable(l logLevel) *Config {
-	if l < 0 || l > 3 {
-		panic("Log level out of range. Use the constants dumdum.")
-	}
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
 
 	lc.Disabled[l] = true
 	return lc
 }
 
+// Flags is a convenience method that sets the standard log package flags (log.Ldate, log.Lmicroseconds, log.LUTC,
+// etc.) used by loggers created from this config. Unlike setting LogFlags directly, 0 really means no flags.
+func (lc *Config) Flags(f int) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if f == 0 {
+		f = NoFlags
+	}
+
+	lc.LogFlags = f
+	return lc
+}
+
+// UTC is a convenience method that turns the log.LUTC flag on or off, keeping the other flags, so the times in
+// messages are written in UTC (to match the names of files from CreateLogFile) instead of local time.
+func (lc *Config) UTC(on bool) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	f := lc.flags()
+	if on {
+		f |= log.LUTC
+	} else {
+		f &^= log.LUTC
+	}
+	if f == 0 {
+		f = NoFlags
+	}
+
+	lc.LogFlags = f
+	return lc
+}
+
+// JSON is a convenience method that turns JSON output on or off. In JSON mode each message is written as a single
+// line JSON object with the fields "level", "time", "id", "endpoint", "msg", and (if the flags include
+// log.Lshortfile or log.Llongfile) "caller". Fields added with WithFields are written as a "fields" object.
+// The time is always written in RFC 3339 format (UTC if the flags include log.LUTC), regardless of the other
+// flags.
+func (lc *Config) JSON(on bool) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.JSONOutput = on
+	return lc
+}
+
+// Format is a convenience method that sets the Formatter used to lay out each message, for layouts that the
+// normal text format and JSON mode do not cover. With a formatter set the prefixes and flags are not used
+// (except for log.LUTC, which makes the time passed to the formatter UTC), fields from WithFields are added to
+// the end of the message as key=value pairs, and the output of the formatter is written exactly as returned. A
+// nil formatter gives the normal output. JSONFormatter and LogfmtFormatter are provided.
+func (lc *Config) Format(f Formatter) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.Formatter = f
+	return lc
+}
+
+// Color is a convenience method that turns colored level tokens on or off. When on, the level token at the start
+// of each message is colored using ANSI escape codes, but only when it is written directly to a terminal. Files
+// and other writers (including terminals wrapped in writers other than those from Writer) stay plain. Colors
+// are never used in JSON mode.
+func (lc *Config) Color(on bool) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.Colorize = on
+	return lc
+}
+
+// Prefix is a convenience method that sets the level token used at the start of messages for the given level,
+// replacing the default ("DBUG", "INFO", "WARN", or " ERR"). The endpoint and ID still follow it. Note that
+// writers that detect the level of a message from its token, such as SyslogWriter, only know about the default
+// tokens. With a Formatter they only find the level in the output of JSONFormatter and LogfmtFormatter (or a
+// custom Formatter that starts its lines with one of the default tokens), other messages are treated as info.
+// Will panic if the level is invalid.
+func (lc *Config) Prefix(l logLevel, p string) *Config {
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.Prefixes[l] = p
+	return lc
+}
+
+func (lc *Config) tokens() [4]string {
+	tokens := levelTokens
+	for l, p := range lc.Prefixes {
+		if p != "" {
+			tokens[l] = p
+		}
+	}
+	return tokens
+}
+
+// prefixFormat holds the strings that surround the endpoint and ID in the prefix.
+type prefixFormat struct {
+	lead, sep, end string
+}
+
+var defaultPrefixFormat = prefixFormat{lead: "@", sep: ":"}
+
+func (lc *Config) prefixFormat() prefixFormat {
+	if lc.format == nil {
+		return defaultPrefixFormat
+	}
+	return *lc.format
+}
+
+// PrefixFormat is a convenience method that sets the strings used around the endpoint and ID in the prefix.
+// lead comes before the endpoint, sep between the endpoint and the ID, and end after the ID (or after the
+// endpoint for a master logger without an ID). The default is "@", ":", and "", giving "INFO@endpoint:id: ",
+// while "[", "|", and "]" give "INFO[endpoint|id]: ". None of them are used for a master logger with an ID but no
+// endpoint, see NewMasterLoggerWithID. The ID field of the logger is not affected.
+func (lc *Config) PrefixFormat(lead, sep, end string) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.format = &prefixFormat{lead: lead, sep: sep, end: end}
+	return lc
+}
+
+// LogSessionStart is a convenience method that controls if new session loggers write an empty message to the info
+// level to mark the start of the session. This is on by default.
+func (lc *Config) LogSessionStart(on bool) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.NoSessionStart = !on
+	return lc
+}
+
+// IDLen is a convenience method that sets the length of the session IDs generated for this config. IDs of a
+// fixed length are made of random characters from the shortid alphabet, so shorter IDs are more likely to
+// collide. Will panic if n is less than MinIDLength or greater than MaxIDLength.
+func (lc *Config) IDLen(n int) *Config {
+	if n < MinIDLength || n > MaxIDLength {
+		panic("ID length out of range. IDs that short or long are not a good idea.")
+	}
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.IDLength = n
+	return lc
+}
+
+func (lc *Config) flags() int {
+	switch lc.LogFlags {
+	case 0:
+		return DefaultFlags
+	case NoFlags:
+		return 0
+	}
+	return lc.LogFlags
+}
+
 // Writer is a convenience method that combines all the given writers and uses them as the output for the
-// given log level.
+// given log level. A single writer is used as it is, unless it is a file, in which case it is wrapped so that
+// ReopenFile can switch it. Use SetWriter to store a file unwrapped.
 func (lc *Config) Writer(l logLevel, w ...io.Writer) *Config {
-	if l < 0 || l > 3 {
-		panic("Log level out of range. Use the constants dumdum.")
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.Writers[l] = combineWriters(reopenable(w)...)
+	return lc
+}
+
+// SetWriter is a convenience method that uses w as the output for the given log level exactly as given, so
+// type assertions against the Writers field work. Files set this way are not switched by ReopenFile.
+func (lc *Config) SetWriter(l logLevel, w io.Writer) *Config {
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.Writers[l] = w
+	return lc
+}
+
+// ConsoleOnly is a convenience method that sets every level back to writing only to its standard stream (Stdout,
+// or Stderr for errors), throwing away any writers set with Writer. Writers added with TeeAtLevel are kept.
+func (lc *Config) ConsoleOnly() *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.Writers = [4]io.Writer{}
+	return lc
+}
+
+// NoConsole is a convenience method that removes Stdout and Stderr from the writers of every level, keeping any
+// files or other writers. Levels that are left with nothing to write to (including levels that were using the
+// default) write to io.Discard, so nothing is written to the console. Only the current writers are changed,
+// writers set with Writer afterwards are used as given.
+func (lc *Config) NoConsole() *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	for l, w := range lc.Writers {
+		writers := []io.Writer{w}
+		if mw, ok := w.(*multiWriter); ok {
+			writers = mw.writers
+		}
+
+		keep := []io.Writer{}
+		for _, w := range writers {
+			if w != nil && w != os.Stdout && w != os.Stderr {
+				keep = append(keep, w)
+			}
+		}
+
+		if len(keep) == 0 {
+			lc.Writers[l] = ioutil.Discard
+		} else {
+			lc.Writers[l] = combineWriters(keep...)
+		}
 	}
+	return lc
+}
 
-	lc.Writers[l] = io.MultiWriter(w...)
+// RateLimit is a convenience method that limits the given log level to perSecond messages per second, shared
+// between all loggers created from this config. Messages over the limit are dropped, and a summary message at
+// the same level with the number dropped is written when the one second window they were dropped in is over
+// (or by Sync or Close, if they come first). A limit of 0 or less removes the rate limit.
+func (lc *Config) RateLimit(l logLevel, perSecond int) *Config {
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.limits[l] = nil
+	if perSecond > 0 {
+		lc.limits[l] = newRateLimit(perSecond)
+	}
+	return lc
+}
+
+// TeeAtLevel is a convenience method that adds w as an extra destination for the given level and every level above
+// it, in addition to (not instead of) their normal writers. Disabled levels are not written to w. Will panic
+// if the level is invalid.
+func (lc *Config) TeeAtLevel(l logLevel, w io.Writer) *Config {
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	w = reopenable([]io.Writer{w})[0]
+	for ; l <= Err; l++ {
+		lc.tees[l] = append(lc.tees[l], w)
+	}
+	return lc
+}
+
+// Filter is a convenience method that adds a filter function for the given log level, for redacting secrets and
+// the like. fn is called with each message for the level, exactly as it would be written: the prefix, the
+// flags, the message itself, and a final line ending (or a single line of JSON in JSON mode). If fn returns nil
+// the message is dropped, otherwise whatever it returns is written instead. fn must not keep or modify msg, but
+// may return it unchanged.
+//
+// Multiple filters for a level are run in the order they were added, and a nil fn removes all the filters for
+// the level. Will panic if the level is invalid.
+func (lc *Config) Filter(l logLevel, fn func(msg []byte) []byte) *Config {
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if fn == nil {
+		lc.filters[l] = nil
+		return lc
+	}
+	lc.filters[l] = append(lc.filters[l], fn)
+	return lc
+}
+
+// MaxLineBytes is a convenience method that limits every message to n bytes, so one huge message cannot swamp the
+// log. Longer messages are cut short and "…(truncated)" is added, along with the line ending if the message had
+// one. Messages are never cut in the middle of a UTF-8 character, so they may be a few bytes shorter than n. In
+// JSON mode a truncated message is no longer valid JSON. A limit of 0 or less removes the limit.
+func (lc *Config) MaxLineBytes(n int) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.maxLine = n
+	return lc
+}
+
+// SanitizeControlChars is a convenience method that makes every message safe to show on a terminal or feed to a
+// line based log reader, even if it includes text from users. Control characters (including ANSI escape
+// sequences and line breaks inside the message), DEL, C1 control characters, and bytes that are not valid UTF-8
+// are written as escapes like "\n" or "\x1b". Tabs, the line ending at the end of the message, and valid
+// printable UTF-8 are left alone. This means multi-line messages (stack dumps, for example) are written on a
+// single line. Filters and MaxLineBytes see the escaped message.
+func (lc *Config) SanitizeControlChars(on bool) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.sanitize = on
 	return lc
 }
 
+// Dedup is a convenience method that collapses runs of identical messages at every log level into a single
+// message. When a message is the same as the one before it on the same level, ignoring the time, and arrives
+// within window of the first copy, it is dropped. Once a different message arrives or the window is over a
+// summary line with the message "(repeated N times)" is written at the same level, where N is the number of
+// copies dropped. Messages from different session loggers have different prefixes, so they are never the same.
+// A window of 0 or less turns this off.
+func (lc *Config) Dedup(window time.Duration) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	for l := range lc.dedups {
+		lc.dedups[l] = nil
+		if window > 0 {
+			lc.dedups[l] = &dedup{window: window}
+		}
+	}
+	return lc
+}
+
+// PrefixEachLine is a convenience method that makes messages with more than one line get the prefix (level token,
+// endpoint, and ID) at the start of every line, not just the first, so every line can be traced back to its
+// session. Only the time and file of the first line are written. This is done by the methods of Logger (Info,
+// Errf, Recover, and so on), messages written with the log.Loggers (l.I.Printf and friends) directly are not
+// changed. It has no effect in JSON mode.
+func (lc *Config) PrefixEachLine(on bool) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.eachLine = on
+	return lc
+}
+
+// Sequenced is a convenience method that turns sequence numbers on or off. When on, every message is started with
+// a sequence number like "#000123 ", before the level token, so messages can be put back in order even if they
+// are written to several places or reordered. One counter is shared by all levels of all loggers created from
+// this config, starting at 1, and every number is used exactly once. Summary lines (from RateLimit or Dedup)
+// get numbers too, but messages that are dropped do not.
+func (lc *Config) Sequenced(on bool) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	lc.seq = on
+	return lc
+}
+
+// TagWriter is a convenience method that sets the writers for a routing tag. Messages written through a logger
+// returned by Logger.Tagged with this tag go to these writers as well as their normal destination, so a single
+// message can go to several places (an audit log, for example) no matter what level it is. Tags are just names,
+// and have nothing to do with levels. Passing no writers removes the tag.
+func (lc *Config) TagWriter(tag string, w ...io.Writer) *Config {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	if len(w) == 0 {
+		delete(lc.tagged, tag)
+		return lc
+	}
+	if lc.tagged == nil {
+		lc.tagged = map[string]io.Writer{}
+	}
+	lc.tagged[tag] = combineWriters(reopenable(w)...)
+	return lc
+}
+
+// taggedWriters returns a copy of the tag writers for a new logger. The lock must be held.
+func (lc *Config) taggedWriters() map[string]io.Writer {
+	if len(lc.tagged) == 0 {
+		return nil
+	}
+	tagged := make(map[string]io.Writer, len(lc.tagged))
+	for tag, w := range lc.tagged {
+		tagged[tag] = w
+	}
+	return tagged
+}
+
+// allWriters returns every writer set in the config, for methods that need to find files and the like.
+func (lc *Config) allWriters() []io.Writer {
+	all := append([]io.Writer{}, lc.Writers[:]...)
+	for _, tees := range lc.tees {
+		all = append(all, tees...)
+	}
+	for _, w := range lc.tagged {
+		all = append(all, w)
+	}
+	return all
+}
+
+// Close closes every writer used by this config that implements io.Closer, after writing the summary of any
+// messages dropped by RateLimit. Writers shared between levels are only closed once, and the standard streams
+// are never closed. All writers are closed even if some of them fail, and the first error encountered is
+// returned.
+//
+// Any loggers created from this config are invalid after Close is called.
+func (lc *Config) Close() error {
+	lc.lock.RLock()
+	all := lc.allWriters()
+	limits := lc.limits
+	lc.lock.RUnlock()
+
+	flushLimits(limits)
+	return closeWriters(all...)
+}
+
+// Sync flushes or syncs every writer used by this config that supports it, after writing the summary of any
+// messages dropped by RateLimit. *os.File and any other writer with a Sync() error method is synced, writers
+// with a Flush() error method (such as AsyncWriter) are flushed. Errors from all writers are returned together.
+func (lc *Config) Sync() error {
+	lc.lock.RLock()
+	all := lc.allWriters()
+	limits := lc.limits
+	lc.lock.RUnlock()
+
+	flushLimits(limits)
+	return syncWriters(all...)
+}
+
+// flushLimits writes the summary of every rate limit with suppressed messages, so it is not lost.
+func flushLimits(limits [4]*rateLimit) {
+	for _, rl := range limits {
+		if rl != nil {
+			rl.flush()
+		}
+	}
+}
+
 var defaultWriters = []io.Writer{
+	os.Stdout,
 	os.Stdout,
 	os.Stdout,
 	os.Stderr,
@@ -75,14 +585,129 @@ var defaultWriters = []io.Writer{
 // GetWriter gets a writer for the given log level. No matter what, a valid writer will be
 // returned (assuming no invalid logger was manually set in the config).
 func (lc *Config) GetWriter(l logLevel) io.Writer {
-	if l < 0 || l > 3 {
+	if !l.valid() {
 		return os.Stdout
 	}
+
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
 	if lc.Disabled[l] {
 		return ioutil.Discard
 	}
-	if lc.Writers[l] == nil {
-		return defaultWriters[l]
+	return lc.destination(l)
+}
+
+// destination is GetWriter without the check for disabled levels. l must be valid, and the lock must be held.
+func (lc *Config) destination(l logLevel) io.Writer {
+	w := lc.Writers[l]
+	if w == nil {
+		w = defaultWriters[l]
+	}
+	if len(lc.tees[l]) > 0 {
+		w = newMultiWriter(append([]io.Writer{w}, lc.tees[l]...)...)
+	}
+	if lc.Colorize && !lc.JSONOutput && lc.Formatter == nil {
+		w = colorize(w, l, lc.tokens()[l])
+	}
+	if lc.seq {
+		w = &seqWriter{w: w, n: &lc.seqN}
+	}
+	// Messages are counted under everything that may drop them, so only the ones that are written count.
+	w = &countingWriter{w: w, n: &lc.counts[l], errs: &lc.failed}
+	if lc.limits[l] != nil {
+		w = &rateLimitWriter{w: w, rl: lc.limits[l], dropped: &lc.dropped, summary: lc.summary(l)}
+	}
+	if lc.dedups[l] != nil {
+		w = &dedupWriter{w: w, d: lc.dedups[l], shape: timestampShape(lc.flags()), dropped: &lc.dropped, summary: lc.summary(l)}
+	}
+	for i := len(lc.filters[l]) - 1; i >= 0; i-- {
+		w = &filterWriter{w: w, fn: lc.filters[l][i]}
+	}
+	if lc.maxLine > 0 {
+		w = &truncateWriter{w: w, max: lc.maxLine}
+	}
+	if lc.sanitize {
+		w = &sanitizeWriter{w: w}
+	}
+	return &groupedWriter{w: w, lock: &lc.groups}
+}
+
+// auditDestination wraps w, the writer of an AuditLogger, in the parts of the chain from destination that never
+// drop a message: sequence numbers, counting, and escaping control characters. The lock must be held.
+func (lc *Config) auditDestination(l logLevel, w io.Writer) io.Writer {
+	if lc.seq {
+		w = &seqWriter{w: w, n: &lc.seqN}
+	}
+	w = &countingWriter{w: w, n: &lc.counts[l], errs: &lc.failed}
+	if lc.sanitize {
+		w = &sanitizeWriter{w: w}
+	}
+	return &groupedWriter{w: w, lock: &lc.groups}
+}
+
+// summary returns a function that lays out a summary line (from RateLimit or Dedup) as a message at level l, in
+// the output format of the config, so it has the level token (or level field) like any other message and writers
+// such as MinLevelWriter handle it the same way. The line has no endpoint, ID, or caller. The lock must be held.
+func (lc *Config) summary(l logLevel) func(msg string) []byte {
+	flags := lc.flags() &^ (log.Lshortfile | log.Llongfile)
+	if lc.JSONOutput || lc.Formatter != nil {
+		utc, clock, format := flags&log.LUTC != 0, lc.Clock, lc.Formatter
+		return func(msg string) []byte {
+			buf := &bytes.Buffer{}
+			jw := &jsonWriter{w: buf, level: l, utc: utc, now: clock, format: format}
+			jw.Write([]byte(msg))
+			return buf.Bytes()
+		}
+	}
+
+	prefix := lc.tokens()[l] + ": "
+	if lc.Clock != nil {
+		hl := &Logger{clock: lc.Clock, flags: flags}
+		return func(msg string) []byte {
+			if flags&log.Lmsgprefix != 0 {
+				return []byte(hl.clockHeaderAt("", 0) + prefix + msg + "\n")
+			}
+			return []byte(prefix + hl.clockHeaderAt("", 0) + msg + "\n")
+		}
+	}
+	return func(msg string) []byte {
+		buf := &bytes.Buffer{}
+		log.New(buf, prefix, flags).Print(msg)
+		return buf.Bytes()
+	}
+}
+
+// Counts returns the number of messages written to the info, warning, and error levels by loggers created from
+// this config. Only messages that reach the writer for the level are counted, so messages sent to disabled levels
+// or dropped by RateLimit, Dedup, or Filter are not, but the summary lines written by RateLimit and Dedup are.
+// Messages the writer failed to write are counted. See DebugCount for the debug level.
+func (lc *Config) Counts() (info, warn, err uint64) {
+	return lc.counts[Info].Load(), lc.counts[Warn].Load(), lc.counts[Err].Load()
+}
+
+// DebugCount returns the number of messages written to the debug level, counted the same way as for Counts.
+func (lc *Config) DebugCount() uint64 {
+	return lc.counts[Debug].Load()
+}
+
+// Stats holds counters for the messages written by loggers created from a config, see Config.Stats.
+type Stats struct {
+	Messages    [4]uint64 // Messages written to each level, as from Counts and DebugCount.
+	Dropped     uint64    // Messages dropped by RateLimit or Dedup. Messages removed by Filter are not counted.
+	WriteErrors uint64    // Messages where the writer for the level returned an error.
+}
+
+// Stats returns the counters for the messages written by loggers created from this config, so problems with
+// logging itself can be noticed. The counters are never reset. Writers that drop messages on their own (such as
+// AsyncWriter and HTTPWriter) have their own Dropped methods, and errors they do not return are not counted.
+func (lc *Config) Stats() Stats {
+	st := Stats{
+		Dropped:     lc.dropped.Load(),
+		WriteErrors: lc.failed.Load(),
+	}
+	for l := range st.Messages {
+		st.Messages[l] = lc.counts[l].Load()
 	}
-	return lc.Writers[l]
+	return st
 }
@@ -0,0 +1,412 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "log"
+import "sync"
+import "time"
+import "os"
+import "fmt"
+import "bytes"
+import "bufio"
+import "errors"
+import "strings"
+import "testing"
+import "runtime"
+import "path/filepath"
+
+// closeCounter is a writer that counts how many times it is closed, optionally failing.
+type closeCounter struct {
+	bytes.Buffer
+	closed int
+	err    error
+}
+
+func (cc *closeCounter) Close() error {
+	cc.closed++
+	return cc.err
+}
+
+func TestCloseSharedWriterOnce(t *testing.T) {
+	shared := &closeCounter{}
+	own := &closeCounter{}
+	lc := (&Config{}).Writer(Info, shared).Writer(Warn, shared, own).Writer(Err, shared)
+
+	err := lc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared.closed != 1 {
+		t.Errorf("shared writer closed %v times, want 1", shared.closed)
+	}
+	if own.closed != 1 {
+		t.Errorf("writer closed %v times, want 1", own.closed)
+	}
+}
+
+func TestCloseKeepsGoingAfterError(t *testing.T) {
+	first := errors.New("first")
+	a := &closeCounter{err: first}
+	b := &closeCounter{err: errors.New("second")}
+	c := &closeCounter{}
+	lc := (&Config{}).Writer(Info, a).Writer(Warn, b).Writer(Err, c)
+
+	err := lc.Close()
+	if err != first {
+		t.Errorf("Close returned %v, want the first error", err)
+	}
+	if a.closed != 1 || b.closed != 1 || c.closed != 1 {
+		t.Errorf("not every writer was closed: %v %v %v", a.closed, b.closed, c.closed)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	lc := (&Config{}).LogSessionStart(false).Disable(Debug)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, io.Discard)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := lc.NewSessionLogger("count")
+			for j := 0; j < 10; j++ {
+				l.Debug("hidden")
+				l.Info("one")
+				l.Warnf("%d", j)
+			}
+			l.Err("done")
+		}()
+	}
+	wg.Wait()
+
+	info, warn, err := lc.Counts()
+	if debug := lc.DebugCount(); debug != 0 || info != 80 || warn != 80 || err != 8 {
+		t.Errorf("Counts() = %v, %v, %v, %v, want 0, 80, 80, 8", debug, info, warn, err)
+	}
+}
+
+func TestInvalidLevelPanics(t *testing.T) {
+	calls := map[string]func(l logLevel){
+		"Disable":   func(l logLevel) { (&Config{}).Disable(l) },
+		"Writer":    func(l logLevel) { (&Config{}).Writer(l, io.Discard) },
+		"Prefix":    func(l logLevel) { (&Config{}).Prefix(l, "X") },
+		"RateLimit": func(l logLevel) { (&Config{}).RateLimit(l, 1) },
+	}
+
+	for name, fn := range calls {
+		for _, l := range []logLevel{-1, 4, 100} {
+			func() {
+				defer func() {
+					r := recover()
+					if _, ok := r.(runtime.Error); ok || r == nil {
+						t.Errorf("%s(%d) panicked with %v, want the out of range message", name, l, r)
+						return
+					}
+					if msg := fmt.Sprint(r); !strings.Contains(msg, fmt.Sprintf("level %d out of range", l)) {
+						t.Errorf("%s(%d) panicked with %q", name, l, msg)
+					}
+				}()
+				fn(l)
+			}()
+		}
+	}
+
+	// GetWriter promises a usable writer no matter what.
+	if w := (&Config{}).GetWriter(4); w != os.Stdout {
+		t.Errorf("GetWriter(4) = %v, want os.Stdout", w)
+	}
+}
+
+func TestLoggerConfigAlias(t *testing.T) {
+	var old *LoggerConfig = &Config{}
+	var cur *Config = &LoggerConfig{}
+
+	old.Flags(NoFlags)
+	cur.Flags(NoFlags)
+	if old.LogFlags != cur.LogFlags {
+		t.Errorf("configs differ: %v and %v", old.LogFlags, cur.LogFlags)
+	}
+}
+
+// flushError is a writer whose Flush always fails.
+type flushError struct {
+	err error
+}
+
+func (fe flushError) Write(p []byte) (int, error) { return len(p), nil }
+func (fe flushError) Flush() error                { return fe.err }
+
+func TestSync(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "sync.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	lc := (&Config{}).Writer(Info, bw).Writer(Err, f).Flags(NoFlags).LogSessionStart(false)
+	l := lc.NewMasterLogger()
+	l.Info("buffered")
+
+	if b, _ := os.ReadFile(f.Name()); len(b) != 0 {
+		t.Fatalf("data written before Sync: %q", b)
+	}
+	if err := lc.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(f.Name()); string(b) != "INFO: buffered\n" {
+		t.Errorf("after Sync the file contains %q", b)
+	}
+}
+
+func TestSyncJoinsErrors(t *testing.T) {
+	e1, e2 := errors.New("one"), errors.New("two")
+	lc := (&Config{}).Writer(Info, flushError{e1}).Writer(Warn, flushError{e2}).Writer(Err, io.Discard)
+
+	err := lc.Sync()
+	if !errors.Is(err, e1) || !errors.Is(err, e2) {
+		t.Errorf("Sync() = %v, want both errors", err)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Prefix(Warn, "careful").Prefix(Err, "[E]")
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, buf)
+	}
+
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+	l.Debug("d")
+	l.Info("i")
+	l.Warn("w")
+	l.Err("e")
+	lc.NewMasterLogger().Err("m")
+
+	want := "DBUG@ep:abc: d\nINFO@ep:abc: i\ncareful@ep:abc: w\n[E]@ep:abc: e\n[E]: m\n"
+	if buf.String() != want {
+		t.Errorf("output %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTeeAtLevel(t *testing.T) {
+	extra := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Disable(Err).TeeAtLevel(Warn, extra)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, io.Discard)
+	}
+
+	l := lc.NewMasterLogger()
+	l.Debug("d")
+	l.Info("i")
+	l.Warn("w")
+	l.Err("disabled")
+	l.SetLevelEnabled(Err, true)
+	l.Err("e")
+
+	want := []string{"WARN: w", " ERR: e"}
+	if got := extra.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("extra writer got %q, want %q", got, want)
+	}
+}
+
+// Run with -race, it checks that the config lock covers the builders and logger construction.
+func TestConfigureWhileConstructing(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Writer(Warn, io.Discard).Writer(Err, io.Discard).LogSessionStart(false)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			lc.Writer(Info, cw).Flags(NoFlags).Prefix(Info, "I").Disable(Debug).IDLen(8).JSON(i%2 == 0)
+			lc.GetWriter(Warn)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			lc.TeeAtLevel(Err, io.Discard).Sequenced(i%3 == 0).UTC(i%2 == 1).RateLimit(Warn, 1000)
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				l := lc.NewSessionLogger("race")
+				l.Info("hello")
+				lc.NewMasterLogger().Warn("master")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if info, _, _ := lc.Counts(); info != 200 {
+		t.Errorf("counted %d info messages, want 200", info)
+	}
+}
+
+func TestNoConsole(t *testing.T) {
+	file := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Info, file, os.Stdout).Writer(Warn, os.Stdout).TeeAtLevel(Err, file).
+		Flags(NoFlags).LogSessionStart(false).NoConsole()
+
+	if lc.Writers[Warn] != io.Discard || lc.Writers[Err] != io.Discard || lc.Writers[Debug] != io.Discard {
+		t.Errorf("levels without a file do not discard: %v", lc.Writers)
+	}
+	if lc.Writers[Info] != io.Writer(file) {
+		t.Errorf("info writer is %v, want just the file", lc.Writers[Info])
+	}
+
+	l := lc.NewMasterLogger()
+	l.Info("kept")
+	l.Warn("gone")
+	l.Err("teed")
+	if file.String() != "INFO: kept\n ERR: teed\n" {
+		t.Errorf("file got %q", file.String())
+	}
+}
+
+func TestConsoleOnly(t *testing.T) {
+	stdout, stderr := swapStdStreams(t)
+
+	file := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Info, file).Writer(Err, file).Flags(NoFlags).LogSessionStart(false).ConsoleOnly()
+
+	l := lc.NewMasterLogger()
+	l.Info("out")
+	l.Err("err")
+	if file.Len() != 0 {
+		t.Errorf("file got %q", file.String())
+	}
+	if stdout.String() != "INFO: out\n" || stderr.String() != " ERR: err\n" {
+		t.Errorf("streams got %q and %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestPrefixFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Info, buf).PrefixFormat("[", "|", "]")
+
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+	l.Info("session")
+	l.Sub("child").Info("sub")
+	lc.NewMasterLogger().Info("master")
+	lc.NewMasterLogger().Sub("stdlog").Info("master with endpoint")
+
+	want := "INFO[ep|abc]: session\nINFO[ep/child|abc]: sub\nINFO: master\nINFO[stdlog]: master with endpoint\n"
+	if buf.String() != want {
+		t.Errorf("output %q, want %q", buf.String(), want)
+	}
+	if l.ID != "abc" {
+		t.Errorf("ID = %q", l.ID)
+	}
+
+	// The defaults give the usual prefix.
+	buf.Reset()
+	lc.PrefixFormat("@", ":", "").NewSessionLoggerWithID("ep", "abc").Info("default")
+	if buf.String() != "INFO@ep:abc: default\n" {
+		t.Errorf("output %q", buf.String())
+	}
+}
+
+func TestCountsFilter(t *testing.T) {
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Debug, io.Discard).Writer(Info, io.Discard).
+		Filter(Info, func(msg []byte) []byte {
+			if strings.Contains(string(msg), "secret") {
+				return nil
+			}
+			return msg
+		})
+
+	l := lc.NewMasterLogger()
+	l.Info("public")
+	l.Info("secret")
+	l.Debug("debug")
+	if info, _, _ := lc.Counts(); info != 1 {
+		t.Errorf("counted %d info messages, want only the one that was written", info)
+	}
+	if debug := lc.DebugCount(); debug != 1 {
+		t.Errorf("DebugCount() = %d", debug)
+	}
+}
+
+// Run with -race, it checks that the counters are shared by every logger from the config.
+func TestStats(t *testing.T) {
+	lc := (&Config{}).LogSessionStart(false).Disable(Debug).Dedup(time.Hour).
+		Writer(Debug, io.Discard).Writer(Info, io.Discard).Writer(Warn, brokenWriter{err: io.ErrClosedPipe}).
+		Writer(Err, io.Discard)
+
+	const loggers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < loggers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := lc.NewMasterLogger()
+			l.Debug("disabled")
+			for j := 0; j < 2; j++ {
+				l.Info("once") // Only the first of all of these is written, the rest are dropped by Dedup.
+			}
+			l.Warnf("fails %d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	st := lc.Stats()
+	if st.Messages != [4]uint64{0, 1, loggers, 0} {
+		t.Errorf("Messages = %v", st.Messages)
+	}
+	if st.Dropped != 2*loggers-1 || st.WriteErrors != loggers {
+		t.Errorf("Dropped = %v, WriteErrors = %v, want %v and %v", st.Dropped, st.WriteErrors, 2*loggers-1, loggers)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	if got := (&Config{}).flags(); got != DefaultFlags {
+		t.Errorf("zero LogFlags gave %b, want DefaultFlags", got)
+	}
+	if got := (&Config{}).NewMasterLogger().I.Flags(); got != DefaultFlags {
+		t.Errorf("logger from the zero config has flags %b, want DefaultFlags", got)
+	}
+
+	lc := (&Config{}).Flags(0)
+	if lc.LogFlags != NoFlags || lc.flags() != 0 {
+		t.Errorf("Flags(0) set LogFlags to %v", lc.LogFlags)
+	}
+	if got := lc.NewMasterLogger().I.Flags(); got != 0 {
+		t.Errorf("logger after Flags(0) has flags %b", got)
+	}
+
+	lc.Flags(log.Ltime | log.LUTC)
+	if got := lc.NewMasterLogger().I.Flags(); got != log.Ltime|log.LUTC {
+		t.Errorf("logger has flags %b", got)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "context"
+import "testing"
+
+func TestContextRoundTrip(t *testing.T) {
+	l := (&Config{}).LogSessionStart(false).NewSessionLogger("ep")
+
+	ctx := ContextWithLogger(context.Background(), l)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if got := LoggerFromContext(ctx); got != l {
+		t.Errorf("LoggerFromContext returned %p, want %p", got, l)
+	}
+}
+
+func TestContextFallback(t *testing.T) {
+	for name, ctx := range map[string]context.Context{
+		"empty": context.Background(),
+		"nil":   ContextWithLogger(context.Background(), nil),
+	} {
+		l := LoggerFromContext(ctx)
+		if l == nil {
+			t.Errorf("%s: LoggerFromContext returned nil", name)
+			continue
+		}
+		if !l.IsMaster() {
+			t.Errorf("%s: fallback logger %q is not a master logger", name, l.ID)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "fmt"
+import "log"
+import "sync"
+import "time"
+import "bytes"
+import "sync/atomic"
+
+// dedup tracks the last message written to a level, so repeats can be collapsed. It is shared by all the
+// writers for a level of a config.
+type dedup struct {
+	window time.Duration
+
+	lock  sync.Mutex
+	last  []byte                  // Key of the last message written, nil if there is none.
+	w     io.Writer               // Where the last message was written, the summary goes there too.
+	sum   func(msg string) []byte // Lays out the summary for w, nil for a plain line.
+	start time.Time
+	count int // Repeats dropped since the last message was written.
+	timer *time.Timer
+}
+
+// dedupWriter drops messages that are the same as the one before them, see Config.Dedup.
+type dedupWriter struct {
+	w       io.Writer
+	d       *dedup
+	shape   []byte                  // Shape of the timestamp written by the log package, see timestampShape.
+	dropped *atomic.Uint64          // Counts dropped repeats, may be nil.
+	summary func(msg string) []byte // Lays out the summary line, see Config.summary. May be nil.
+}
+
+func (dw *dedupWriter) Write(p []byte) (int, error) {
+	d := dw.d
+	key := dedupKey(p, dw.shape)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	if d.last != nil && bytes.Equal(key, d.last) && now.Sub(d.start) < d.window {
+		d.count++
+		if dw.dropped != nil {
+			dw.dropped.Add(1)
+		}
+		if d.timer == nil {
+			d.timer = time.AfterFunc(d.window-now.Sub(d.start), d.expire)
+		}
+		return len(p), nil
+	}
+
+	d.flush()
+	d.last = key
+	d.w = dw.w
+	d.sum = dw.summary
+	d.start = now
+	return dw.w.Write(p)
+}
+
+func (dw *dedupWriter) unwrap() []io.Writer {
+	return []io.Writer{dw.w}
+}
+
+// expire is called when the window for the last message is over, so the next copy of it is written as usual.
+func (d *dedup) expire() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.flush()
+	d.last = nil
+}
+
+// flush writes the summary of dropped repeats, if there were any. The lock must be held.
+func (d *dedup) flush() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.count > 0 {
+		msg := fmt.Sprintf("(repeated %d times)", d.count)
+		if d.sum != nil {
+			d.w.Write(d.sum(msg))
+		} else {
+			io.WriteString(d.w, msg+"\n")
+		}
+		d.count = 0
+	}
+}
+
+// timestampShape returns the shape of the date and time the log package writes with the given flags, with a '0'
+// for every digit, or nil if there is none.
+func timestampShape(flags int) []byte {
+	shape := []byte{}
+	if flags&log.Ldate != 0 {
+		shape = append(shape, "0000/00/00 "...)
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		shape = append(shape, "00:00:00"...)
+		if flags&log.Lmicroseconds != 0 {
+			shape = append(shape, ".000000"...)
+		}
+		shape = append(shape, ' ')
+	}
+	if len(shape) == 0 {
+		return nil
+	}
+	return shape
+}
+
+// dedupKey returns a copy of the message with the time blanked out, so it can be compared to other messages. For
+// JSON messages the "time" field is blanked, otherwise the first thing that matches the shape of the timestamp
+// (as given by timestampShape) has all its digits replaced with '0'.
+func dedupKey(p, shape []byte) []byte {
+	key := append([]byte{}, p...)
+
+	const jsonTime = `"time":"`
+	if len(key) > 0 && key[0] == '{' {
+		i := bytes.Index(key, []byte(jsonTime))
+		if i >= 0 {
+			i += len(jsonTime)
+			j := bytes.IndexByte(key[i:], '"')
+			if j >= 0 {
+				key = append(key[:i], key[i+j:]...)
+			}
+		}
+		return key
+	}
+
+	if shape == nil {
+		return key
+	}
+	for i := 0; i+len(shape) <= len(key); i++ {
+		if matchShape(key[i:i+len(shape)], shape) {
+			copy(key[i:], shape)
+			break
+		}
+	}
+	return key
+}
+
+// matchShape reports if b matches shape, where a '0' in shape matches any digit.
+func matchShape(b, shape []byte) bool {
+	for i, c := range shape {
+		if c == '0' {
+			if b[i] < '0' || b[i] > '9' {
+				return false
+			}
+		} else if b[i] != c {
+			return false
+		}
+	}
+	return true
+}
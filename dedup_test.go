@@ -0,0 +1,112 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "log"
+import "bytes"
+import "time"
+import "strings"
+import "testing"
+
+func TestDedup(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Writer(Warn, cw).Flags(log.Ldate | log.Lmicroseconds).LogSessionStart(false).
+		Dedup(time.Hour)
+	a := lc.NewSessionLoggerWithID("ep", "a")
+	b := lc.NewSessionLoggerWithID("ep", "b")
+
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Microsecond) // So the timestamps differ.
+		a.Info("same")
+	}
+	a.Warn("other level") // Levels are tracked separately.
+	a.Info("different")
+	b.Info("different") // Another logger has another prefix.
+	a.Info("same")
+	a.Info("same")
+	a.Info("end")
+
+	got := []string{}
+	for _, line := range cw.Lines() {
+		// Drop the date and time.
+		if fields := strings.SplitN(line, " ", 4); len(fields) == 4 && strings.HasSuffix(fields[0], ":") {
+			line = fields[0] + " " + fields[3]
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		"INFO@ep:a: same",
+		"WARN@ep:a: other level",
+		"INFO: (repeated 4 times)",
+		"INFO@ep:a: different",
+		"INFO@ep:b: different",
+		"INFO@ep:a: same",
+		"INFO: (repeated 1 times)",
+		"INFO@ep:a: end",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if lc.Stats().Dropped != 5 {
+		t.Errorf("Stats().Dropped = %v, want 5", lc.Stats().Dropped)
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	cw := &CaptureWriter{}
+	l := (&Config{}).Writer(Err, cw).Flags(NoFlags).LogSessionStart(false).Dedup(20 * time.Millisecond).NewMasterLogger()
+
+	l.Err("flaky")
+	l.Err("flaky")
+	l.Err("flaky")
+
+	// The summary is written when the window is over, even if nothing else is logged.
+	deadline := time.Now().Add(5 * time.Second)
+	for !cw.Contains("(repeated") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	l.Err("flaky")
+
+	want := " ERR: flaky\n ERR: (repeated 2 times)\n ERR: flaky\n"
+	if cw.String() != want {
+		t.Errorf("output %q, want %q", cw.String(), want)
+	}
+}
+
+func TestDedupSummaryJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).Writer(Err, buf).JSON(true).LogSessionStart(false).Dedup(time.Hour).NewMasterLogger()
+
+	for i := 0; i < 2; i++ {
+		l.Err("flaky") // On one line, so the callers match.
+	}
+	l.Err("done")
+
+	entries, err := ParseEntries(buf)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("ParseEntries = %v entries, %v", len(entries), err)
+	}
+	if e := entries[1]; e.Level != "err" || e.Msg != "(repeated 1 times)" {
+		t.Errorf("summary entry = %+v", e)
+	}
+}
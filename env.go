@@ -0,0 +1,106 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "errors"
+import "strconv"
+
+// Environment variables read by ConfigFromEnv.
+const (
+	EnvLevel = "LOG_LEVEL" // Minimum level, as accepted by ParseLevel.
+	EnvDir   = "LOG_DIR"   // Directory to create a log file in, see NewFileConfig.
+	EnvJSON  = "LOG_JSON"  // JSON output, as accepted by strconv.ParseBool.
+	EnvColor = "LOG_COLOR" // Colored level tokens, as accepted by strconv.ParseBool.
+)
+
+// ConfigFromEnv creates a config from the environment variables EnvLevel, EnvDir, EnvJSON, and EnvColor. Unset
+// (or empty) variables leave the default. If EnvDir is set a log file is created in that directory, and every
+// level writes to it as well as to the standard streams, like NewFileConfig.
+//
+// Bad values are reported to Stderr and ignored, use ConfigFromEnvE to get the errors instead.
+func ConfigFromEnv() *Config {
+	lc, err := configFromEnv()
+	if err != nil {
+		selfLog.Print(err)
+	}
+	return lc
+}
+
+// ConfigFromEnvE is ConfigFromEnv, but if any of the variables have bad values (or the log file cannot be
+// created) an error describing all the problems is returned instead of a config.
+func ConfigFromEnvE() (*Config, error) {
+	lc, err := configFromEnv()
+	if err != nil {
+		// Don't leak the log file if it was the other variables that were bad.
+		lc.Close()
+		return nil, err
+	}
+	return lc, nil
+}
+
+// configFromEnv creates a config from the environment, skipping bad values. The errors for them are returned
+// joined together, along with the config.
+func configFromEnv() (*Config, error) {
+	lc := &Config{}
+	errs := []error{}
+
+	if dir := os.Getenv(EnvDir); dir != "" {
+		f, err := CreateLogFile(dir)
+		if err != nil {
+			errs = append(errs, errors.New("sessionlogger: creating log file from "+EnvDir+" failed: "+err.Error()))
+		} else {
+			for l := Debug; l <= Err; l++ {
+				lc.Writer(l, f, defaultWriters[l])
+			}
+		}
+	}
+
+	if s := os.Getenv(EnvLevel); s != "" {
+		l, err := ParseLevel(s)
+		if err != nil {
+			errs = append(errs, errors.New("sessionlogger: bad "+EnvLevel+": unknown log level "+strconv.Quote(s)))
+		} else {
+			lc.SetMinLevel(l)
+		}
+	}
+
+	for _, v := range []struct {
+		name string
+		set  func(bool) *Config
+	}{{EnvJSON, lc.JSON}, {EnvColor, lc.Color}} {
+		s := os.Getenv(v.name)
+		if s == "" {
+			continue
+		}
+
+		on, err := strconv.ParseBool(s)
+		if err != nil {
+			errs = append(errs, errors.New("sessionlogger: bad "+v.name+": "+strconv.Quote(s)+" is not a boolean"))
+			continue
+		}
+		v.set(on)
+	}
+
+	return lc, errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "bytes"
+import "strings"
+import "testing"
+import "path/filepath"
+
+// setEnv sets the ConfigFromEnv variables for the rest of the test, with unlisted ones empty.
+func setEnv(t *testing.T, vars map[string]string) {
+	for _, name := range []string{EnvLevel, EnvDir, EnvJSON, EnvColor} {
+		t.Setenv(name, vars[name])
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	stdout, _ := swapStdStreams(t)
+	dir := filepath.Join(t.TempDir(), "logs")
+	setEnv(t, map[string]string{EnvLevel: "warn", EnvDir: dir, EnvJSON: "true", EnvColor: "0"})
+
+	lc, err := ConfigFromEnvE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lc.Close()
+
+	if lc.Disabled != [4]bool{true, true, false, false} {
+		t.Errorf("disabled levels %v, want only warn and err enabled", lc.Disabled)
+	}
+	if !lc.JSONOutput || lc.Colorize {
+		t.Errorf("JSONOutput = %v, Colorize = %v", lc.JSONOutput, lc.Colorize)
+	}
+
+	lc.NewMasterLogger().Warn("to both")
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("log files %v (%v), want one", files, err)
+	}
+	b, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(b), `"msg":"to both"`) || !strings.Contains(stdout.String(), `"msg":"to both"`) {
+		t.Errorf("file got %q and stdout got %q", b, stdout.String())
+	}
+}
+
+func TestConfigFromEnvDefaults(t *testing.T) {
+	setEnv(t, nil)
+
+	lc, err := ConfigFromEnvE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc.Disabled != [4]bool{} || lc.Writers != [4]io.Writer{} || lc.JSONOutput || lc.Colorize {
+		t.Errorf("config from an empty environment is not the zero config: %+v", lc)
+	}
+}
+
+func TestConfigFromEnvErrors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	setEnv(t, map[string]string{EnvLevel: "loud", EnvDir: dir, EnvJSON: "yes please"})
+
+	lc, err := ConfigFromEnvE()
+	if err == nil {
+		t.Fatalf("bad values accepted: %+v", lc)
+	}
+	for _, want := range []string{`bad LOG_LEVEL: unknown log level "loud"`, `bad LOG_JSON: "yes please" is not a boolean`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	// ConfigFromEnv reports the problems and keeps the good values.
+	warnings := &bytes.Buffer{}
+	selfLog.SetOutput(warnings)
+	defer selfLog.SetOutput(os.Stderr)
+
+	lc = ConfigFromEnv()
+	defer lc.Close()
+	if lc.Disabled != [4]bool{} || lc.JSONOutput || lc.Writers[Info] == nil {
+		t.Errorf("config with bad values: %+v", lc)
+	}
+	if !strings.Contains(warnings.String(), "bad LOG_LEVEL") {
+		t.Errorf("warnings %q", warnings.String())
+	}
+}
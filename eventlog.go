@@ -0,0 +1,73 @@
+//go:build windows
+
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "strings"
+
+import "golang.org/x/sys/windows/svc/eventlog"
+
+// eventLogID is the event ID used for every message.
+const eventLogID = 1
+
+type eventLogWriter struct {
+	l *eventlog.Log
+}
+
+// EventLogWriter opens the Windows Event Log for the given source and returns a writer that records each message
+// as an event with a type matching its log level: errors are Error events, warnings are Warning events, and
+// everything else is an Information event. The level is detected from the level token at the start of the
+// message, so use the same writer for any or all levels. The source must already be registered, for example
+// with eventlog.InstallAsEventCreate when the service is installed.
+//
+// The Event Log is only available on Windows, elsewhere this always returns an error.
+func EventLogWriter(source string) (io.Writer, error) {
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogWriter{l}, nil
+}
+
+func (ew *eventLogWriter) Write(p []byte) (int, error) {
+	var err error
+	msg := strings.TrimSuffix(string(p), "\n")
+	switch lineLevel(p) {
+	case Warn:
+		err = ew.l.Warning(eventLogID, msg)
+	case Err:
+		err = ew.l.Error(eventLogID, msg)
+	default:
+		err = ew.l.Info(eventLogID, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (ew *eventLogWriter) Close() error {
+	return ew.l.Close()
+}
@@ -0,0 +1,61 @@
+//go:build windows
+
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "testing"
+
+import "golang.org/x/sys/windows/svc/eventlog"
+
+func TestEventLogWriter(t *testing.T) {
+	const source = "sessionlogger-test"
+	err := eventlog.InstallAsEventCreate(source, eventlog.Info|eventlog.Warning|eventlog.Error)
+	if err != nil {
+		t.Skipf("registering an event source needs administrator rights: %v", err)
+	}
+	defer eventlog.Remove(source)
+
+	w, err := EventLogWriter(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.(io.Closer).Close()
+
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, w)
+	}
+	l := lc.NewSessionLogger("eventlog")
+	l.Info("information event")
+	l.Warn("warning event")
+	l.Err("error event")
+
+	if _, warn, err := lc.Counts(); warn != 1 || err != 1 {
+		t.Errorf("counted %v warnings and %v errors", warn, err)
+	}
+	if st := lc.Stats(); st.WriteErrors != 0 {
+		t.Errorf("%v events failed", st.WriteErrors)
+	}
+}
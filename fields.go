@@ -0,0 +1,106 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "fmt"
+import "sort"
+import "bytes"
+import "strings"
+
+// WithFields returns a derived logger that appends the given fields to every message as key=value pairs,
+// sorted by key. The derived logger has the same ID and writes to the same writers, the original logger is
+// not changed. Calling WithFields on a derived logger adds to (or replaces) the existing fields.
+func (l *Logger) WithFields(fields map[string]any) *Logger {
+	return l.derive(func(_ logLevel, w io.Writer) io.Writer {
+		if jw, ok := w.(*jsonWriter); ok {
+			njw := *jw
+			njw.fields = mergeFields(jw.fields, fields)
+			return &njw
+		}
+
+		var all map[string]any
+		if fw, ok := w.(*fieldsWriter); ok {
+			w = fw.w
+			all = mergeFields(fw.fields, fields)
+		} else {
+			all = mergeFields(nil, fields)
+		}
+		return &fieldsWriter{w: w, fields: all, suffix: formatFields(all)}
+	})
+}
+
+// mergeFields returns a new map with the contents of a and b. Keys in b override keys in a.
+func mergeFields(a, b map[string]any) map[string]any {
+	all := make(map[string]any, len(a)+len(b))
+	for k, v := range a {
+		all[k] = v
+	}
+	for k, v := range b {
+		all[k] = v
+	}
+	return all
+}
+
+// formatFields renders fields as key=value pairs sorted by key, each with a leading space.
+func formatFields(fields map[string]any) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := &strings.Builder{}
+	for _, k := range keys {
+		b.WriteString(" ")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(quoteValue(fmt.Sprint(fields[k])))
+	}
+	return b.String()
+}
+
+// fieldsWriter adds a suffix to the end of each message, before the trailing newline.
+type fieldsWriter struct {
+	w      io.Writer
+	fields map[string]any
+	suffix string
+}
+
+func (fw *fieldsWriter) Write(p []byte) (int, error) {
+	msg := bytes.TrimSuffix(p, []byte("\n"))
+	buf := make([]byte, 0, len(p)+len(fw.suffix)+1)
+	buf = append(buf, msg...)
+	buf = append(buf, fw.suffix...)
+	buf = append(buf, '\n')
+
+	_, err := fw.w.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (fw *fieldsWriter) unwrap() []io.Writer {
+	return []io.Writer{fw.w}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "bytes"
+import "testing"
+
+func TestWithFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, buf)
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	fields := map[string]any{"user": "bob", "n": 3, "note": "two words"}
+	fl := l.WithFields(fields)
+	fields["user"] = "changed after the call"
+
+	fl.Debug("d")
+	fl.Info("i")
+	fl.Warnf("%s", "w")
+	fl.Err("e")
+	l.Info("plain")
+
+	more := fl.WithFields(map[string]any{"n": 4, "extra": true})
+	more.Info("more")
+	fl.Info("again")
+
+	want := `DBUG@ep:abc: d n=3 note="two words" user=bob
+INFO@ep:abc: i n=3 note="two words" user=bob
+WARN@ep:abc: w n=3 note="two words" user=bob
+ ERR@ep:abc: e n=3 note="two words" user=bob
+INFO@ep:abc: plain
+INFO@ep:abc: more extra=true n=4 note="two words" user=bob
+INFO@ep:abc: again n=3 note="two words" user=bob
+`
+	if buf.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if fl.ID != l.ID {
+		t.Errorf("derived logger has ID %q, want %q", fl.ID, l.ID)
+	}
+}
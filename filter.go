@@ -0,0 +1,83 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+
+// filterWriter passes each write through a filter function before writing it.
+type filterWriter struct {
+	w  io.Writer
+	fn func(msg []byte) []byte
+}
+
+// FilterWriter wraps w so that every write is passed to fn first. If fn returns nil the write is dropped (but
+// reported as successful), otherwise whatever fn returned is written in its place. Since the log package makes
+// one write per message, fn is called once for each complete message, see Config.Filter for the format.
+func FilterWriter(w io.Writer, fn func(msg []byte) []byte) io.Writer {
+	return &filterWriter{w: w, fn: fn}
+}
+
+func (fw *filterWriter) Write(p []byte) (int, error) {
+	msg := fw.fn(p)
+	if msg == nil {
+		return len(p), nil
+	}
+
+	_, err := fw.w.Write(msg)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (fw *filterWriter) unwrap() []io.Writer {
+	return []io.Writer{fw.w}
+}
+
+// minLevelWriter drops writes below a level.
+type minLevelWriter struct {
+	w   io.Writer
+	min logLevel
+}
+
+// MinLevelWriter wraps w so that only messages at or above the given level are passed through, so it can be
+// given to Writer (or TeeAtLevel) for every level but only get the important messages. The level of each message
+// is found from the level token at the start of it, or the level field in JSON mode (or from JSONFormatter or
+// LogfmtFormatter), so this only works with the default level tokens (see Config.Prefix). Messages with no level
+// token are treated as info. Will panic if the level is invalid.
+func MinLevelWriter(min logLevel, w io.Writer) io.Writer {
+	min.mustBeValid()
+
+	return &minLevelWriter{w: w, min: min}
+}
+
+func (mw *minLevelWriter) Write(p []byte) (int, error) {
+	if lineLevel(p) < mw.min {
+		return len(p), nil
+	}
+	return mw.w.Write(p)
+}
+
+func (mw *minLevelWriter) unwrap() []io.Writer {
+	return []io.Writer{mw.w}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "bytes"
+import "regexp"
+import "strings"
+import "testing"
+
+func TestFilter(t *testing.T) {
+	secret := regexp.MustCompile(`password=\S+`)
+	redact := func(msg []byte) []byte {
+		return secret.ReplaceAll(msg, []byte("password=[REDACTED, NICE TRY]"))
+	}
+	noHealth := func(msg []byte) []byte {
+		if bytes.Contains(msg, []byte("GET /health")) {
+			return nil
+		}
+		return msg
+	}
+	shout := func(msg []byte) []byte {
+		return bytes.ToUpper(msg)
+	}
+
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Info, buf).Writer(Warn, buf).Flags(NoFlags).LogSessionStart(false).
+		Filter(Info, redact).Filter(Info, noHealth).Filter(Warn, shout)
+	l := lc.NewMasterLogger()
+
+	l.Info("login user=bob password=hunter2")
+	l.Info("GET /health 200")
+	l.Info("fine")
+	l.Warn("password=x is not filtered here")
+
+	want := "INFO: login user=bob password=[REDACTED, NICE TRY]\nINFO: fine\nWARN: PASSWORD=X IS NOT FILTERED HERE\n"
+	if buf.String() != want {
+		t.Errorf("output %q, want %q", buf.String(), want)
+	}
+
+	// A nil filter removes the others.
+	buf.Reset()
+	lc.Filter(Info, nil)
+	lc.NewMasterLogger().Info("GET /health password=1")
+	if buf.String() != "INFO: GET /health password=1\n" {
+		t.Errorf("after removing the filters: %q", buf.String())
+	}
+}
+
+func TestFilterWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := FilterWriter(buf, func(msg []byte) []byte {
+		return append([]byte(">>> "), msg...)
+	})
+
+	n, err := w.Write([]byte("short\n"))
+	if n != 6 || err != nil {
+		t.Errorf("Write returned %v, %v, want the length of the original", n, err)
+	}
+	if buf.String() != ">>> short\n" {
+		t.Errorf("wrote %q", buf.String())
+	}
+}
+
+func TestMinLevelWriter(t *testing.T) {
+	for _, json := range []bool{false, true} {
+		alerts := &CaptureWriter{}
+		lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).JSON(json).Sequenced(true)
+		for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+			lc.Writer(lvl, io.Discard, MinLevelWriter(Err, alerts))
+		}
+
+		l := lc.NewSessionLoggerWithID("ep", "abc")
+		l.Debug("d")
+		l.Info("i")
+		l.Warn("w")
+		l.Err("page someone")
+
+		got := alerts.Lines()
+		if len(got) != 1 || !strings.Contains(got[0], "page someone") {
+			t.Errorf("JSON %v: alert writer got %q, want only the error", json, got)
+		}
+	}
+}
+
+func TestMinLevelWriterFormatter(t *testing.T) {
+	for _, f := range []Formatter{JSONFormatter{}, LogfmtFormatter{}} {
+		alerts := &CaptureWriter{}
+		lc := (&Config{}).Format(f).LogSessionStart(false).Sequenced(true)
+		for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+			lc.Writer(lvl, io.Discard, MinLevelWriter(Warn, alerts))
+		}
+
+		l := lc.NewSessionLoggerWithID("ep", "abc")
+		l.Info("i")
+		l.Warn("w")
+		l.Err("e")
+
+		got := alerts.Lines()
+		if len(got) != 2 || !strings.Contains(got[0], "warn") || !strings.Contains(got[1], "err") {
+			t.Errorf("%T: alert writer got %q, want the warning and the error", f, got)
+		}
+	}
+}
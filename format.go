@@ -0,0 +1,76 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "time"
+import "bytes"
+import "encoding/json"
+
+// Formatter lays out a message for Config.Format. Format is given the level, the logger ID and endpoint, the
+// message (without a line ending), and the time, and returns the bytes to write, which should end with a line
+// ending. It is called from every goroutine that logs, so it must be safe for concurrent use.
+type Formatter interface {
+	Format(level Level, id, endpoint, msg string, t time.Time) []byte
+}
+
+// JSONFormatter is a Formatter that writes each message as a JSON object on a single line, like JSON mode but
+// without the caller, and with fields as part of the message.
+type JSONFormatter struct{}
+
+// Format implements Formatter.
+func (JSONFormatter) Format(level Level, id, endpoint, msg string, t time.Time) []byte {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(&Entry{
+		Level:    level.String(),
+		Time:     t.Format(time.RFC3339Nano),
+		ID:       id,
+		Endpoint: endpoint,
+		Msg:      msg,
+	})
+	return buf.Bytes()
+}
+
+// LogfmtFormatter is a Formatter that writes each message in logfmt style, as key=value pairs with the keys
+// "time", "level", "id", "endpoint", and "msg", in that order. Values are quoted if needed. Empty endpoints are
+// left out.
+type LogfmtFormatter struct{}
+
+// Format implements Formatter.
+func (LogfmtFormatter) Format(level Level, id, endpoint, msg string, t time.Time) []byte {
+	buf := make([]byte, 0, 64+len(msg))
+	buf = append(buf, "time="...)
+	buf = t.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, " level="...)
+	buf = append(buf, level.String()...)
+	buf = append(buf, " id="...)
+	buf = append(buf, quoteValue(id)...)
+	if endpoint != "" {
+		buf = append(buf, " endpoint="...)
+		buf = append(buf, quoteValue(endpoint)...)
+	}
+	buf = append(buf, " msg="...)
+	buf = append(buf, quoteValue(msg)...)
+	return append(buf, '\n')
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "log"
+import "time"
+import "strings"
+import "testing"
+
+// pipeFormatter lays out messages as level|id|endpoint|msg|time.
+type pipeFormatter struct{}
+
+func (pipeFormatter) Format(level Level, id, endpoint, msg string, t time.Time) []byte {
+	return []byte(strings.Join([]string{level.String(), id, endpoint, msg, t.Format("15:04:05")}, "|") + "\n")
+}
+
+var formatClock = func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+func TestFormatter(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{Clock: formatClock}).Format(pipeFormatter{}).Flags(log.Lshortfile).LogSessionStart(false).
+		Prefix(Warn, "ignored")
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, cw)
+	}
+
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+	l.Warn("custom")
+	l.WithFields(map[string]any{"user": "bob"}).Sub("child").Err("with fields")
+	lc.NewMasterLogger().Info("master")
+
+	want := []string{
+		"warn|abc|ep|custom|05:06:07",
+		"err|abc|ep/child|with fields user=bob|05:06:07",
+		"info|MASTER||master|05:06:07",
+	}
+	if got := cw.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A nil formatter is the normal output.
+	cw.Reset()
+	lc.Format(nil).Flags(NoFlags).NewSessionLoggerWithID("ep", "abc").Info("normal")
+	if cw.String() != "INFO@ep:abc: normal\n" {
+		t.Errorf("output %q", cw.String())
+	}
+}
+
+func TestProvidedFormatters(t *testing.T) {
+	cases := []struct {
+		f    Formatter
+		want string
+	}{
+		{JSONFormatter{}, `{"level":"info","time":"2022-03-04T05:06:07Z","id":"abc","endpoint":"/api","msg":"say \"hi\" <now>"}` + "\n"},
+		{LogfmtFormatter{}, `time=2022-03-04T05:06:07Z level=info id=abc endpoint=/api msg="say \"hi\" <now>"` + "\n"},
+	}
+	for _, c := range cases {
+		cw := &CaptureWriter{}
+		lc := (&Config{Clock: formatClock}).Format(c.f).LogSessionStart(false).Writer(Info, cw)
+		lc.NewSessionLoggerWithID("/api", "abc").Info(`say "hi" <now>`)
+
+		if cw.String() != c.want {
+			t.Errorf("%T wrote %q, want %q", c.f, cw.String(), c.want)
+		}
+	}
+
+	if got := string(LogfmtFormatter{}.Format(Err, "abc", "", "x", formatClock())); got != "time=2022-03-04T05:06:07Z level=err id=abc msg=x\n" {
+		t.Errorf("empty endpoint gave %q", got)
+	}
+}
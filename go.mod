@@ -1,5 +1,13 @@
 module github.com/milochristiansen/sessionlogger
 
-go 1.17
+go 1.21
 
-require github.com/teris-io/shortid v0.0.0-20201117134242-e59966efd125
+require (
+	github.com/teris-io/shortid v0.0.0-20201117134242-e59966efd125
+	go.opentelemetry.io/otel/trace v1.24.0
+	go.uber.org/goleak v1.3.0
+	golang.org/x/sys v0.20.0
+	golang.org/x/term v0.20.0
+)
+
+require go.opentelemetry.io/otel v1.24.0 // indirect
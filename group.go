@@ -0,0 +1,125 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "sync"
+
+// GroupLogger is the logger passed to the function given to Logger.Group. It works exactly like the logger Group
+// was called on, but messages are held back until the function returns.
+type GroupLogger struct {
+	*Logger
+
+	lock    sync.Mutex
+	done    bool
+	entries []groupEntry
+}
+
+type groupEntry struct {
+	w io.Writer
+	p []byte
+}
+
+// Group calls fn with a logger that holds back every message written through it until fn returns (or panics),
+// then writes them all at once, in order, so several related lines appear together instead of mixed in with the
+// output of other goroutines. While the group is written every other write by loggers created from the same
+// config waits, so nothing else comes between its messages. Each message is still passed on as a write of its
+// own, so Counts, Sequenced, and the like see every message.
+//
+// The GroupLogger may be used from several goroutines, but only messages written before fn returns are grouped,
+// anything written to it afterwards is written right away.
+func (l *Logger) Group(fn func(g *GroupLogger)) {
+	g := &GroupLogger{}
+	g.Logger = l.derive(func(_ logLevel, out io.Writer) io.Writer {
+		return replaceDestination(out, &groupWriter{g: g, w: baseDestination(out)})
+	})
+
+	defer g.flush()
+	fn(g)
+}
+
+// flush writes out everything held back, and makes later writes go straight through.
+func (g *GroupLogger) flush() {
+	g.lock.Lock()
+	entries := g.entries
+	g.entries = nil
+	g.done = true
+	g.lock.Unlock()
+
+	// Every entry comes from the same config, so they all share its lock.
+	for _, e := range entries {
+		if gw, ok := e.w.(*groupedWriter); ok {
+			gw.lock.Lock()
+			defer gw.lock.Unlock()
+			break
+		}
+	}
+	for _, e := range entries {
+		if gw, ok := e.w.(*groupedWriter); ok {
+			gw.w.Write(e.p)
+			continue
+		}
+		e.w.Write(e.p)
+	}
+}
+
+// groupWriter holds back writes for a GroupLogger.
+type groupWriter struct {
+	g *GroupLogger
+	w io.Writer
+}
+
+func (gw *groupWriter) Write(p []byte) (int, error) {
+	gw.g.lock.Lock()
+	if !gw.g.done {
+		// The log package reuses its buffer, so the data must be copied.
+		gw.g.entries = append(gw.g.entries, groupEntry{w: gw.w, p: append([]byte(nil), p...)})
+		gw.g.lock.Unlock()
+		return len(p), nil
+	}
+	gw.g.lock.Unlock()
+
+	return gw.w.Write(p)
+}
+
+func (gw *groupWriter) unwrap() []io.Writer {
+	return []io.Writer{gw.w}
+}
+
+// groupedWriter is the outermost writer of every destination of a config. Writes hold its lock for reading, so
+// they wait while a group is written with the lock held for writing.
+type groupedWriter struct {
+	w    io.Writer
+	lock *sync.RWMutex
+}
+
+func (gw *groupedWriter) Write(p []byte) (int, error) {
+	gw.lock.RLock()
+	defer gw.lock.RUnlock()
+
+	return gw.w.Write(p)
+}
+
+func (gw *groupedWriter) unwrap() []io.Writer {
+	return []io.Writer{gw.w}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "sync"
+import "strings"
+import "testing"
+
+func TestGroup(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Info, cw).Writer(Err, cw)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	l.Group(func(g *GroupLogger) {
+		g.Info("one")
+		l.Info("outside")
+		g.Infof("%v", "two")
+		g.Err("three")
+	})
+
+	want := []string{"INFO@ep:abc: outside", "INFO@ep:abc: one", "INFO@ep:abc: two", " ERR@ep:abc: three"}
+	if got := cw.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGroupPanic(t *testing.T) {
+	cw := &CaptureWriter{}
+	l := (&Config{}).Flags(NoFlags).Writer(Info, cw).NewMasterLogger()
+
+	func() {
+		defer func() { recover() }()
+		l.Group(func(g *GroupLogger) {
+			g.Info("before the panic")
+			panic("oops")
+		})
+	}()
+	if cw.String() != "INFO: before the panic\n" {
+		t.Errorf("output %q", cw.String())
+	}
+}
+
+func TestGroupSequencedCounts(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Info, cw).Sequenced(true)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	l.Group(func(g *GroupLogger) {
+		g.Info("one")
+		g.Info("two")
+		g.Info("three")
+	})
+
+	want := []string{"#000001 INFO@ep:abc: one", "#000002 INFO@ep:abc: two", "#000003 INFO@ep:abc: three"}
+	if got := cw.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if info, _, _ := lc.Counts(); info != 3 {
+		t.Errorf("Counts() info = %v, want 3", info)
+	}
+}
+
+// Run with -race.
+func TestGroupConcurrent(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Info, cw)
+
+	const groups, lines = 20, 10
+	var wg sync.WaitGroup
+	for i := 0; i < groups; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			lc.NewSessionLoggerWithID("ep", fmt.Sprint(i)).Group(func(g *GroupLogger) {
+				for j := 0; j < lines; j++ {
+					g.Infof("group %d line %d", i, j)
+				}
+			})
+		}(i)
+		go func() {
+			defer wg.Done()
+			lc.NewMasterLogger().Info("noise")
+		}()
+	}
+	wg.Wait()
+
+	got := cw.Lines()
+	for i := 0; i < len(got); i++ {
+		var g, j int
+		if _, err := fmt.Sscanf(got[i][strings.Index(got[i], ": ")+2:], "group %d line %d", &g, &j); err != nil {
+			continue
+		}
+		if j != 0 || i+lines > len(got) {
+			t.Fatalf("line %d: %q does not start a complete group", i, got[i])
+		}
+		for j := 1; j < lines; j++ {
+			if want := fmt.Sprintf("group %d line %d", g, j); !strings.HasSuffix(got[i+j], want) {
+				t.Fatalf("line %d: %q, want %q", i+j, got[i+j], want)
+			}
+		}
+		i += lines - 1
+	}
+	if len(got) != groups*lines+groups {
+		t.Errorf("%d lines, want %d", len(got), groups*lines+groups)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "net"
+import "time"
+import "bufio"
+import "net/http"
+
+// Middleware wraps an HTTP handler so every request gets its own session logger from DefaultConfig. See
+// Config.Middleware for details.
+func Middleware(next http.Handler) http.Handler {
+	return DefaultConfigSnapshot().Middleware(next)
+}
+
+// RequestIDHeader is the request header Middleware takes the session ID from.
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware wraps an HTTP handler so every request gets its own session logger, using the request path as
+// the endpoint. The path is used in its escaped form (see url.URL.EscapedPath) everywhere it is logged, so a
+// client cannot add line breaks or fake prefixes to the log. If the request has an X-Request-ID header its value
+// is used as the session ID (cleaned up as described for NewSessionLoggerWithID), so the messages can be matched
+// up with those of the client and other services, otherwise an ID is generated as usual. The logger is stored in
+// the request context (use LoggerFromContext to get it), and the method, path, status, and duration of the
+// request are logged to the info level when the handler returns.
+//
+// If Register is set the logger is released when the handler returns. Keep in mind that clients choose the
+// header, so several requests may have the same ID at once; LoggerByID finds only the first of them.
+func (lc *Config) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		path := r.URL.EscapedPath()
+		l := lc.NewSessionLoggerWithID(path, r.Header.Get(RequestIDHeader))
+		defer l.Release()
+		l.Infof("%s %s", r.Method, path)
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ContextWithLogger(r.Context(), l)))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		l.Infof("%s %s %d %v", r.Method, path, sw.status, time.Since(start))
+	})
+}
+
+// statusWriter records the status code written to a ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush passes a flush on to the original ResponseWriter, for handlers that check for http.Flusher. It does nothing
+// if the original cannot flush.
+func (sw *statusWriter) Flush() {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Hijack passes a hijack on to the original ResponseWriter, for handlers that check for http.Hijacker.
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(sw.ResponseWriter).Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the original ResponseWriter.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
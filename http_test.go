@@ -0,0 +1,191 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "log"
+import "time"
+import "bytes"
+import "strings"
+import "testing"
+import "net/http"
+import "net/http/httptest"
+
+func TestMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Info, buf).Flags(NoFlags).LogSessionStart(false)
+
+	h := lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFromContext(r.Context()).Info("brewing")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/teapot", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %v", rec.Code)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", buf.String())
+	}
+
+	prefix, _, _ := strings.Cut(lines[0], ": ")
+	if !strings.HasPrefix(prefix, "INFO@/teapot:") || len(prefix) == len("INFO@/teapot:") {
+		t.Fatalf("bad prefix on %q", lines[0])
+	}
+	for i, want := range []string{"POST /teapot", "brewing", "POST /teapot 418 "} {
+		if !strings.HasPrefix(lines[i], prefix+": "+want) {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], prefix+": "+want)
+		}
+	}
+}
+
+func TestMiddlewareDefaultStatus(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Info, buf).Flags(NoFlags).LogSessionStart(false)
+
+	h := lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hi"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hi", nil))
+
+	if !strings.Contains(buf.String(), ": GET /hi 200 ") {
+		t.Errorf("missing default status in %q", buf.String())
+	}
+}
+
+func TestMiddlewareReleases(t *testing.T) {
+	lc := &Config{Register: true}
+	lc.Writer(Info, &bytes.Buffer{}).LogSessionStart(false)
+
+	found := false
+	h := lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, found = LoggerByID("mw-release")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "mw-release")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !found {
+		t.Errorf("logger was not registered while the handler ran")
+	}
+	if _, ok := LoggerByID("mw-release"); ok {
+		t.Errorf("logger still registered after the request")
+	}
+	count := 0
+	lc.ForEachLogger(func(*Logger) { count++ })
+	if count != 0 {
+		t.Errorf("%d live loggers left in the config", count)
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Flags(NoFlags).LogSessionStart(false)
+
+	ids := []string{}
+	h := lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, LoggerFromContext(r.Context()).ID)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "req-42: forged\nline")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if len(ids) != 2 || ids[0] != "req-42forgedline" || ids[1] == "" || ids[1] == ids[0] {
+		t.Errorf("IDs = %q", ids)
+	}
+	if !strings.HasPrefix(cw.Lines()[0], "INFO@/:req-42forgedline: GET /") {
+		t.Errorf("first line %q", cw.Lines()[0])
+	}
+}
+
+func TestMiddlewareEscapesPath(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Flags(NoFlags).LogSessionStart(false)
+	h := lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a%0AINFO@fake:xyz:%20forged", nil))
+
+	got := cw.Lines()
+	if len(got) != 2 {
+		t.Fatalf("got %q, want two lines", got)
+	}
+	for _, line := range got {
+		if strings.HasPrefix(line, "INFO@fake") || !strings.Contains(line, "/a%0AINFO@fake:xyz:%20forged") {
+			t.Errorf("path not escaped in %q", line)
+		}
+	}
+}
+
+func TestMiddlewareFlushAndHijack(t *testing.T) {
+	lc := (&Config{}).Writer(Info, io.Discard).LogSessionStart(false)
+
+	rec := httptest.NewRecorder()
+	lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+	})).ServeHTTP(rec, httptest.NewRequest("GET", "/stream", nil))
+	if !rec.Flushed {
+		t.Error("flush did not reach the recorder")
+	}
+
+	srv := httptest.NewServer(lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := io.ReadAll(resp.Body); string(b) != "hijacked" {
+		t.Errorf("body %q", b)
+	}
+}
+
+func TestMiddlewareClock(t *testing.T) {
+	clock := func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC) }
+	buf := &bytes.Buffer{}
+	lc := (&Config{Clock: clock}).Writer(Info, buf).Flags(log.Ltime).LogSessionStart(false)
+
+	h := lc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/tea", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.HasPrefix(buf.String(), "INFO@/tea:abc: 05:06:07 GET /tea\nINFO@/tea:abc: 05:06:07 GET /tea 200 ") {
+		t.Errorf("output %q", buf.String())
+	}
+}
@@ -0,0 +1,312 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "sync"
+import "sync/atomic"
+import "time"
+import "bytes"
+import "strconv"
+import "net/http"
+import "encoding/json"
+
+// HTTPWriter is an io.Writer that sends log messages to a remote collector with HTTP POST requests. Messages are
+// collected into batches and sent from a background goroutine, so writing never waits on the network. If the
+// buffer is full, or a batch still fails after all retries, messages are dropped and a warning is written to
+// Stderr. Warnings about a full buffer are written at most once a minute, with the number dropped so far.
+type HTTPWriter struct {
+	url        string
+	client     *http.Client
+	batchSize  int
+	interval   time.Duration
+	auth       string
+	jsonArray  bool
+	maxRetries int
+	backoff    time.Duration
+	bufferSize int
+
+	c       chan []byte
+	flushes chan chan struct{}
+	done    chan struct{}
+
+	lock     sync.RWMutex // Write lock is only held to close c.
+	closed   bool
+	dropped  atomic.Uint64
+	fullWarn atomic.Int64 // When the last warning about a full buffer was written, in Unix nanoseconds.
+}
+
+// httpFullWarnInterval is how often HTTPWriter warns about a full buffer.
+const httpFullWarnInterval = time.Minute
+
+// HTTPWriterOption is an option for NewHTTPWriter.
+type HTTPWriterOption func(hw *HTTPWriter)
+
+// HTTPBatchSize sets the maximum number of messages sent in one request. The default is 100.
+func HTTPBatchSize(n int) HTTPWriterOption {
+	return func(hw *HTTPWriter) { hw.batchSize = n }
+}
+
+// HTTPFlushInterval sets how often a partial batch is sent. The default is one second.
+func HTTPFlushInterval(d time.Duration) HTTPWriterOption {
+	return func(hw *HTTPWriter) { hw.interval = d }
+}
+
+// HTTPAuthHeader sets the value of the Authorization header sent with each request, for example "Bearer xyz".
+func HTTPAuthHeader(value string) HTTPWriterOption {
+	return func(hw *HTTPWriter) { hw.auth = value }
+}
+
+// HTTPJSONArray makes the writer send each batch as a JSON array instead of newline delimited messages. Messages
+// that are valid JSON (as in JSON mode) are included as is, others are included as strings.
+func HTTPJSONArray() HTTPWriterOption {
+	return func(hw *HTTPWriter) { hw.jsonArray = true }
+}
+
+// HTTPRetries sets how many times a failed request is retried, and the delay before the first retry. The delay
+// doubles after each attempt. The default is 3 retries starting at 100ms.
+func HTTPRetries(n int, backoff time.Duration) HTTPWriterOption {
+	return func(hw *HTTPWriter) { hw.maxRetries, hw.backoff = n, backoff }
+}
+
+// HTTPBufferSize sets how many messages may be waiting to be sent before new ones are dropped. The default is
+// 1000.
+func HTTPBufferSize(n int) HTTPWriterOption {
+	return func(hw *HTTPWriter) { hw.bufferSize = n }
+}
+
+// HTTPClient sets the client used to send requests. The default is a client with a 10 second timeout.
+func HTTPClient(c *http.Client) HTTPWriterOption {
+	return func(hw *HTTPWriter) { hw.client = c }
+}
+
+// NewHTTPWriter creates an HTTPWriter that posts messages to url. Call Close to send anything still buffered and
+// stop the background goroutine.
+func NewHTTPWriter(url string, opts ...HTTPWriterOption) *HTTPWriter {
+	hw := &HTTPWriter{
+		url:        url,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		batchSize:  100,
+		interval:   time.Second,
+		maxRetries: 3,
+		backoff:    100 * time.Millisecond,
+		bufferSize: 1000,
+		flushes:    make(chan chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(hw)
+	}
+	if hw.batchSize < 1 {
+		hw.batchSize = 1
+	}
+	if hw.interval <= 0 {
+		hw.interval = time.Second
+	}
+	hw.c = make(chan []byte, hw.bufferSize)
+
+	go hw.run()
+	return hw
+}
+
+// Write queues a copy of p to be sent. It never blocks on the network, and only returns an error if the writer is
+// closed.
+func (hw *HTTPWriter) Write(p []byte) (int, error) {
+	hw.lock.RLock()
+	defer hw.lock.RUnlock()
+
+	if hw.closed {
+		return 0, os.ErrClosed
+	}
+
+	select {
+	case hw.c <- append([]byte(nil), p...):
+	default:
+		hw.dropped.Add(1)
+		hw.warnFull()
+	}
+	return len(p), nil
+}
+
+// warnFull writes a warning that the buffer is full, unless one was written in the last httpFullWarnInterval.
+func (hw *HTTPWriter) warnFull() {
+	now := time.Now().UnixNano()
+	last := hw.fullWarn.Load()
+	if last != 0 && now-last < int64(httpFullWarnInterval) || !hw.fullWarn.CompareAndSwap(last, now) {
+		return
+	}
+	selfLog.Printf("sessionlogger: buffer for %v is full, %v messages dropped so far", hw.url, hw.dropped.Load())
+}
+
+// Flush blocks until every message written before the call has been sent (or dropped).
+func (hw *HTTPWriter) Flush() error {
+	hw.lock.RLock()
+	if hw.closed {
+		hw.lock.RUnlock()
+		return nil
+	}
+	hw.lock.RUnlock()
+
+	done := make(chan struct{})
+	select {
+	case hw.flushes <- done:
+		<-done
+	case <-hw.done:
+	}
+	return nil
+}
+
+// Close sends any buffered messages and stops the background goroutine.
+func (hw *HTTPWriter) Close() error {
+	hw.lock.Lock()
+	if !hw.closed {
+		hw.closed = true
+		close(hw.c)
+	}
+	hw.lock.Unlock()
+
+	<-hw.done
+	return nil
+}
+
+// Dropped returns the number of messages that were dropped.
+func (hw *HTTPWriter) Dropped() uint64 {
+	return hw.dropped.Load()
+}
+
+func (hw *HTTPWriter) run() {
+	defer close(hw.done)
+
+	ticker := time.NewTicker(hw.interval)
+	defer ticker.Stop()
+
+	batch := [][]byte{}
+	for {
+		select {
+		case p, ok := <-hw.c:
+			if !ok {
+				hw.send(batch)
+				return
+			}
+			batch = append(batch, p)
+			if len(batch) >= hw.batchSize {
+				hw.send(batch)
+				batch = [][]byte{}
+			}
+		case <-ticker.C:
+			hw.send(batch)
+			batch = [][]byte{}
+		case done := <-hw.flushes:
+			// Pick up anything written before the flush was requested.
+			for len(hw.c) > 0 {
+				batch = append(batch, <-hw.c)
+				if len(batch) >= hw.batchSize {
+					hw.send(batch)
+					batch = [][]byte{}
+				}
+			}
+			hw.send(batch)
+			batch = [][]byte{}
+			close(done)
+		}
+	}
+}
+
+// send posts a batch, retrying as configured. If it cannot be sent the batch is dropped.
+func (hw *HTTPWriter) send(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, ctype := hw.encode(batch)
+	delay := hw.backoff
+	var err error
+	for attempt := 0; attempt <= hw.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var retry bool
+		retry, err = hw.post(body, ctype)
+		if err == nil || !retry {
+			break
+		}
+	}
+	if err != nil {
+		hw.dropped.Add(uint64(len(batch)))
+		selfLog.Printf("sessionlogger: dropped %v messages for %v: %v", len(batch), hw.url, err)
+	}
+}
+
+func (hw *HTTPWriter) encode(batch [][]byte) ([]byte, string) {
+	if !hw.jsonArray {
+		return bytes.Join(batch, nil), "application/x-ndjson"
+	}
+
+	msgs := make([]json.RawMessage, len(batch))
+	for i, p := range batch {
+		p = bytes.TrimSuffix(p, []byte("\n"))
+		if json.Valid(p) {
+			msgs[i] = p
+			continue
+		}
+		msgs[i], _ = json.Marshal(string(p))
+	}
+	body, _ := json.Marshal(msgs)
+	return body, "application/json"
+}
+
+// post sends one request. If it fails, retry reports if trying again might help.
+func (hw *HTTPWriter) post(body []byte, ctype string) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, hw.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", ctype)
+	if hw.auth != "" {
+		req.Header.Set("Authorization", hw.auth)
+	}
+
+	resp, err := hw.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = &httpStatusError{resp.StatusCode}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+type httpStatusError struct {
+	code int
+}
+
+func (err *httpStatusError) Error() string {
+	return "unexpected status " + strconv.Itoa(err.code) + " " + http.StatusText(err.code)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "fmt"
+import "sync"
+import "time"
+import "bytes"
+import "strings"
+import "testing"
+import "net/http"
+import "net/http/httptest"
+import "encoding/json"
+
+// collector is an HTTP handler that records the bodies posted to it, failing the first failures requests with
+// the given status.
+type collector struct {
+	lock     sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	failures int
+	status   int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.failures > 0 {
+		c.failures--
+		w.WriteHeader(c.status)
+		return
+	}
+	c.bodies = append(c.bodies, string(b))
+	c.headers = append(c.headers, r.Header.Clone())
+}
+
+func (c *collector) received() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]string(nil), c.bodies...)
+}
+
+func newCollector(t *testing.T, c *collector, opts ...HTTPWriterOption) *HTTPWriter {
+	t.Helper()
+
+	srv := httptest.NewServer(c)
+	opts = append([]HTTPWriterOption{HTTPClient(srv.Client()), HTTPFlushInterval(time.Hour)}, opts...)
+	hw := NewHTTPWriter(srv.URL, opts...)
+	t.Cleanup(func() {
+		hw.Close()
+		srv.Close()
+	})
+	return hw
+}
+
+func TestHTTPWriterBatches(t *testing.T) {
+	c := &collector{}
+	hw := newCollector(t, c, HTTPBatchSize(3), HTTPAuthHeader("Bearer xyz"))
+
+	for i := 0; i < 7; i++ {
+		fmt.Fprintf(hw, "msg %d\n", i)
+	}
+	hw.Flush()
+
+	want := []string{"msg 0\nmsg 1\nmsg 2\n", "msg 3\nmsg 4\nmsg 5\n", "msg 6\n"}
+	if got := c.received(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("bodies = %q, want %q", got, want)
+	}
+	for _, h := range c.headers {
+		if h.Get("Authorization") != "Bearer xyz" || h.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("bad headers: %v", h)
+		}
+	}
+}
+
+func TestHTTPWriterJSONArray(t *testing.T) {
+	c := &collector{}
+	hw := newCollector(t, c, HTTPJSONArray())
+
+	hw.Write([]byte(`{"level":"info","msg":"structured"}` + "\n"))
+	hw.Write([]byte("INFO: plain text\n"))
+	hw.Flush()
+
+	got := c.received()
+	if len(got) != 1 {
+		t.Fatalf("bodies = %q", got)
+	}
+	msgs := []any{}
+	if err := json.Unmarshal([]byte(got[0]), &msgs); err != nil {
+		t.Fatalf("body %q is not a JSON array: %v", got[0], err)
+	}
+	if m, ok := msgs[0].(map[string]any); !ok || m["msg"] != "structured" {
+		t.Errorf("first element = %#v", msgs[0])
+	}
+	if msgs[1] != "INFO: plain text" {
+		t.Errorf("second element = %#v", msgs[1])
+	}
+}
+
+func TestHTTPWriterRetries(t *testing.T) {
+	c := &collector{failures: 2, status: http.StatusServiceUnavailable}
+	hw := newCollector(t, c, HTTPRetries(3, time.Millisecond))
+
+	hw.Write([]byte("eventually\n"))
+	hw.Flush()
+
+	if got := c.received(); len(got) != 1 || got[0] != "eventually\n" {
+		t.Errorf("bodies = %q", got)
+	}
+	if hw.Dropped() != 0 {
+		t.Errorf("Dropped() = %v after a successful retry", hw.Dropped())
+	}
+}
+
+func TestHTTPWriterGivesUp(t *testing.T) {
+	warnings := &bytes.Buffer{}
+	selfLog.SetOutput(warnings)
+	defer selfLog.SetOutput(os.Stderr)
+
+	// Client errors are not retried, server errors are until the retries run out.
+	for _, status := range []int{http.StatusBadRequest, http.StatusBadGateway} {
+		warnings.Reset()
+		c := &collector{failures: 10, status: status}
+		hw := newCollector(t, c, HTTPRetries(2, time.Millisecond))
+
+		hw.Write([]byte("a\n"))
+		hw.Write([]byte("b\n"))
+		hw.Flush()
+
+		wantLeft := 9
+		if status >= 500 {
+			wantLeft = 7
+		}
+		if c.failures != wantLeft {
+			t.Errorf("status %d: made %d requests", status, 10-c.failures)
+		}
+		if hw.Dropped() != 2 {
+			t.Errorf("status %d: Dropped() = %v, want 2", status, hw.Dropped())
+		}
+		if !strings.Contains(warnings.String(), "dropped 2 messages") {
+			t.Errorf("status %d: warning = %q", status, warnings.String())
+		}
+	}
+}
+
+func TestHTTPWriterWarnsWhenFull(t *testing.T) {
+	warnings := &bytes.Buffer{}
+	selfLog.SetOutput(warnings)
+	defer selfLog.SetOutput(os.Stderr)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	hw := NewHTTPWriter(srv.URL, HTTPClient(srv.Client()), HTTPBatchSize(1), HTTPBufferSize(1))
+	defer hw.Close()
+	defer close(release)
+
+	// The first message is stuck being sent and the second fills the buffer, so the rest are dropped.
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(hw, "msg %d\n", i)
+	}
+
+	if hw.Dropped() < 8 {
+		t.Errorf("Dropped() = %v, want at least 8", hw.Dropped())
+	}
+	if n := strings.Count(warnings.String(), "is full"); n != 1 {
+		t.Errorf("wrote %d warnings, want 1: %q", n, warnings.String())
+	}
+}
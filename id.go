@@ -0,0 +1,198 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "sync"
+import "time"
+import "crypto/rand"
+
+import "github.com/teris-io/shortid"
+
+// idService generates unique IDs in a background goroutine until it is stopped.
+type idService struct {
+	c    chan idResult
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newIDService() *idService {
+	s := &idService{
+		c:    make(chan idResult),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+
+		idsource := shortid.MustNew(16, shortid.DefaultABC, uint64(time.Now().UnixNano()))
+
+		for {
+			id, err := idsource.Generate()
+			select {
+			case s.c <- idResult{id, err}:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// idResult is an ID from the service, or the error from trying to generate one.
+type idResult struct {
+	id  string
+	err error
+}
+
+// Stop stops the service and waits for its goroutine to exit. It is safe to call more than once.
+func (s *idService) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+var idServiceLock sync.Mutex
+var idServiceCurrent *idService
+
+// idSource replaces the ID service if not nil. See SetIDSource.
+var idSource func() string
+
+func init() {
+	idServiceCurrent = newIDService()
+}
+
+// nextID gets an ID from the ID service, restarting it if it was shut down. Will panic if the service fails to
+// generate an ID.
+func nextID() string {
+	idServiceLock.Lock()
+	defer idServiceLock.Unlock()
+
+	if idSource != nil {
+		return idSource()
+	}
+	if idServiceCurrent == nil {
+		idServiceCurrent = newIDService()
+	}
+	r := <-idServiceCurrent.c
+	if r.err != nil {
+		panic("Generating a session ID failed. *shrug* Guess I'll die.\n" + r.err.Error())
+	}
+	return r.id
+}
+
+// Shutdown stops the background goroutine that generates session IDs. This is mostly useful for tests that
+// check for leaked goroutines. If a session logger is created after Shutdown the service is restarted.
+func Shutdown() {
+	idServiceLock.Lock()
+	defer idServiceLock.Unlock()
+
+	if idServiceCurrent == nil {
+		return
+	}
+	idServiceCurrent.Stop()
+	idServiceCurrent = nil
+}
+
+// SetIDSource replaces the generator of session IDs for every config that does not set IDGenerator or IDLength
+// (including DefaultConfig) with fn, so tests can get predictable IDs. Calls to fn are never made concurrently,
+// so a simple counter is fine. Passing nil goes back to the normal generator.
+//
+//	n := 0
+//	sessionlogger.SetIDSource(func() string {
+//		n++
+//		return fmt.Sprintf("ID%04d", n)
+//	})
+//	defer sessionlogger.SetIDSource(nil)
+func SetIDSource(fn func() string) {
+	idServiceLock.Lock()
+	defer idServiceLock.Unlock()
+
+	idSource = fn
+}
+
+// Limits for Config.IDLen and Config.IDLength.
+const (
+	MinIDLength = 4
+	MaxIDLength = 64
+)
+
+// randomID generates a random ID of the given length using the shortid alphabet.
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic("Reading random bytes failed. *shrug* Guess I'll die.\n" + err.Error())
+	}
+
+	// The alphabet has exactly 64 characters, so masking the bytes picks from it uniformly.
+	for i := range b {
+		b[i] = shortid.DefaultABC[b[i]&63]
+	}
+	return string(b)
+}
+
+// tryNewID is newID, but a panic while generating the ID (from the built in generators or from IDGenerator or
+// the function given to SetIDSource) is returned as an error, as is an IDLength that IDLen would not accept. The
+// lock must be held.
+func (lc *Config) tryNewID() (id string, err error) {
+	if n := lc.IDLength; lc.IDGenerator == nil && n != 0 && (n < MinIDLength || n > MaxIDLength) {
+		return "", fmt.Errorf("sessionlogger: ID length %d is out of range [%d, %d]", n, MinIDLength, MaxIDLength)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sessionlogger: generating a session ID failed: %v", r)
+		}
+	}()
+	return lc.newID(), nil
+}
+
+// newID gets a session ID as configured. The lock must be held.
+func (lc *Config) newID() string {
+	if lc.IDGenerator != nil {
+		return lc.IDGenerator()
+	}
+	if lc.IDLength > 0 {
+		return randomID(lc.IDLength)
+	}
+	return nextID()
+}
+
+// sanitizeID removes everything from an ID given by the user except letters, digits, and "-_.+=~", so IDs taken
+// from outside (such as a request header) cannot break up the prefix or add lines, and cuts it down to
+// MaxIDLength bytes.
+func sanitizeID(id string) string {
+	clean := make([]byte, 0, len(id))
+	for i := 0; i < len(id) && len(clean) < MaxIDLength; i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == '+', c == '=', c == '~':
+		default:
+			continue
+		}
+		clean = append(clean, c)
+	}
+	return string(clean)
+}
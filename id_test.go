@@ -0,0 +1,235 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "bytes"
+import "errors"
+import "strings"
+import "testing"
+
+import "go.uber.org/goleak"
+import "github.com/teris-io/shortid"
+
+func TestShutdownStopsIDService(t *testing.T) {
+	lc := (&Config{}).LogSessionStart(false)
+	lc.NewSessionLogger("before")
+
+	Shutdown()
+	Shutdown()
+	goleak.VerifyNone(t)
+
+	// The service starts again when it is needed.
+	a, b := lc.NewSessionLogger("after"), lc.NewSessionLogger("after")
+	if a.ID == "" || a.ID == b.ID {
+		t.Errorf("bad IDs after restart: %q and %q", a.ID, b.ID)
+	}
+}
+
+func TestIDLen(t *testing.T) {
+	for _, n := range []int{MinIDLength, 10, MaxIDLength} {
+		lc := (&Config{}).IDLen(n).LogSessionStart(false)
+		seen := map[string]bool{}
+		for i := 0; i < 50; i++ {
+			id := lc.NewSessionLogger("ep").ID
+			if len(id) != n {
+				t.Fatalf("IDLen(%d) gave %q", n, id)
+			}
+			for _, c := range []byte(id) {
+				if strings.IndexByte(shortid.DefaultABC, c) < 0 {
+					t.Fatalf("IDLen(%d) gave %q, which is not from the shortid alphabet", n, id)
+				}
+			}
+			seen[id] = true
+		}
+		if n >= 10 && len(seen) != 50 {
+			t.Errorf("IDLen(%d) gave %d unique IDs out of 50", n, len(seen))
+		}
+	}
+}
+
+func TestIDLenOutOfRange(t *testing.T) {
+	for _, n := range []int{-1, 0, MinIDLength - 1, MaxIDLength + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("IDLen(%d) did not panic", n)
+				}
+			}()
+			(&Config{}).IDLen(n)
+		}()
+	}
+}
+
+func TestIDLengthOutOfRange(t *testing.T) {
+	for _, n := range []int{-1, 1, MaxIDLength + 1, 1000} {
+		lc := &Config{IDLength: n}
+		l, err := lc.TryNewSessionLogger("ep")
+		if l != nil || err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("IDLength %d: TryNewSessionLogger = %v, %v", n, l, err)
+		}
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	n := 0
+	buf := &bytes.Buffer{}
+	lc := &Config{
+		IDGenerator: func() string {
+			n++
+			return fmt.Sprintf("host-%d", n)
+		},
+	}
+	lc.Writer(Info, buf).Flags(NoFlags).LogSessionStart(false)
+
+	a := lc.NewSessionLogger("ep")
+	b := lc.NewSessionLogger("ep")
+	if a.ID != "host-1" || b.ID != "host-2" {
+		t.Fatalf("IDs = %q, %q", a.ID, b.ID)
+	}
+
+	b.Info("second")
+	a.Info("first")
+	if got, want := buf.String(), "INFO@ep:host-2: second\nINFO@ep:host-1: first\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestSetIDSource(t *testing.T) {
+	n := 0
+	SetIDSource(func() string {
+		n++
+		return fmt.Sprintf("ID%04d", n)
+	})
+	restored := false
+	defer func() {
+		if !restored {
+			SetIDSource(nil)
+		}
+	}()
+
+	lc := (&Config{}).LogSessionStart(false)
+	a := lc.NewSessionLogger("a")
+	b, _ := lc.TryNewSessionLogger("b")
+	got := []string{a.ID, b.ID, lc.NewSessionLoggers("c", "d")["d"].ID}
+	if strings.Join(got, " ") != "ID0001 ID0002 ID0004" {
+		t.Errorf("IDs = %q", got)
+	}
+
+	// Configs with their own generator are not affected.
+	if id := (&Config{}).IDLen(6).LogSessionStart(false).NewSessionLogger("e").ID; len(id) != 6 || n != 4 {
+		t.Errorf("IDLen config got ID %q from the source", id)
+	}
+
+	SetIDSource(nil)
+	restored = true
+	if id := lc.NewSessionLogger("f").ID; strings.HasPrefix(id, "ID0") || n != 4 {
+		t.Errorf("source still used after reset, got %q", id)
+	}
+}
+
+func TestTryNewSessionLogger(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := &Config{IDGenerator: func() string { panic("out of IDs") }}
+	lc.Writer(Info, cw)
+
+	l, err := lc.TryNewSessionLogger("ep")
+	if l != nil || err == nil || !strings.Contains(err.Error(), "out of IDs") {
+		t.Errorf("TryNewSessionLogger = %v, %v", l, err)
+	}
+	if cw.String() != "" {
+		t.Errorf("failed logger wrote %q", cw.String())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("NewSessionLogger did not panic")
+			}
+		}()
+		lc.NewSessionLogger("ep")
+	}()
+
+	// An explicit ID does not need the generator.
+	if l := lc.NewSessionLoggerWithID("ep", "given"); l.ID != "given" {
+		t.Errorf("ID = %q", l.ID)
+	}
+}
+
+func TestTryNewSessionLoggerIDSource(t *testing.T) {
+	SetIDSource(func() string { panic(errors.New("source broke")) })
+	defer SetIDSource(nil)
+
+	_, err := (&Config{}).LogSessionStart(false).TryNewSessionLogger("ep")
+	if err == nil || !strings.Contains(err.Error(), "source broke") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestNewSessionLoggers(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw)
+
+	loggers := lc.NewSessionLoggers("worker-1", "worker-2", "worker-3", "worker-2")
+	if len(loggers) != 3 {
+		t.Fatalf("got %d loggers, want 3", len(loggers))
+	}
+
+	ids := map[string]bool{}
+	for endpoint, l := range loggers {
+		if l.Endpoint() != endpoint {
+			t.Errorf("logger for %q has the endpoint %q", endpoint, l.Endpoint())
+		}
+		if ids[l.ID] {
+			t.Errorf("ID %q used twice", l.ID)
+		}
+		ids[l.ID] = true
+	}
+
+	// Duplicate endpoints get a single logger, so only three sessions were started.
+	if got := cw.Lines(); len(got) != 3 {
+		t.Errorf("session start messages %q", got)
+	}
+}
+
+func TestNewSessionLoggerWithIDSanitizes(t *testing.T) {
+	lc := (&Config{}).LogSessionStart(false)
+
+	cases := map[string]string{
+		"abc-123_x.y+z=~":        "abc-123_x.y+z=~",
+		"evil:id@host\n INFO:":   "evilidhostINFO",
+		strings.Repeat("a", 100): strings.Repeat("a", MaxIDLength),
+	}
+	for in, want := range cases {
+		if got := lc.NewSessionLoggerWithID("ep", in).ID; got != want {
+			t.Errorf("ID %q became %q, want %q", in, got, want)
+		}
+	}
+
+	// Nothing left means a generated ID.
+	for _, in := range []string{"", ": @\n"} {
+		if id := lc.NewSessionLoggerWithID("ep", in).ID; id == "" {
+			t.Errorf("ID %q did not get a generated ID", in)
+		}
+	}
+}
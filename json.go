@@ -0,0 +1,155 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "fmt"
+import "bufio"
+import "bytes"
+import "time"
+import "encoding/json"
+
+// jsonWriter turns the output of a log.Logger into JSON objects, or whatever format gives. The log.Logger must
+// have no prefix, and no flags other than log.Lshortfile or log.Llongfile.
+type jsonWriter struct {
+	w        io.Writer
+	level    logLevel
+	id       string
+	endpoint string
+	utc      bool
+	caller   bool // If the log.Logger has one of the file flags set.
+	fields   map[string]any
+	now      func() time.Time // Config.Clock, nil for the system clock.
+	format   Formatter        // Config.Formatter, nil for JSON.
+}
+
+// Entry is a single message as written in JSON mode. Time is formatted as RFC 3339 with nanoseconds, and Caller
+// is only set if one of the file flags was used.
+type Entry struct {
+	Level    string         `json:"level"`
+	Time     string         `json:"time"`
+	ID       string         `json:"id"`
+	Endpoint string         `json:"endpoint"`
+	Msg      string         `json:"msg"`
+	Caller   string         `json:"caller,omitempty"`
+	Fields   map[string]any `json:"fields,omitempty"`
+}
+
+func (jw *jsonWriter) Write(p []byte) (int, error) {
+	t := time.Now()
+	if jw.now != nil {
+		t = jw.now()
+	}
+	if jw.utc {
+		t = t.UTC()
+	}
+
+	msg := bytes.TrimSuffix(p, []byte("\n"))
+	caller := []byte(nil)
+	if i := bytes.Index(msg, []byte(": ")); jw.caller && i >= 0 {
+		// With the file flags set the log package starts the message with "file.go:12: ".
+		caller, msg = msg[:i], msg[i+2:]
+	}
+
+	if jw.format != nil {
+		m := string(msg)
+		if len(jw.fields) > 0 {
+			m += formatFields(jw.fields)
+		}
+		_, err := jw.w.Write(jw.format.Format(jw.level, jw.id, jw.endpoint, m, t))
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(&Entry{
+		Level:    jw.level.String(),
+		Time:     t.Format(time.RFC3339Nano),
+		ID:       jw.id,
+		Endpoint: jw.endpoint,
+		Msg:      string(msg),
+		Caller:   string(caller),
+		Fields:   jw.fields,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = jw.w.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (jw *jsonWriter) unwrap() []io.Writer {
+	return []io.Writer{jw.w}
+}
+
+// ScanEntries reads JSON log lines from r and calls fn with each one, in order. Blank lines are ignored, and lines
+// that are not valid entries are skipped and counted. A sequence number added by Config.Sequenced is allowed at
+// the start of a line. The returned error is only set if reading from r failed.
+func ScanEntries(r io.Reader, fn func(e Entry)) (skipped int, err error) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			line = line[seqLen(line):]
+
+			e := Entry{}
+			if json.Unmarshal(line, &e) != nil {
+				skipped++
+			} else {
+				fn(e)
+			}
+		}
+
+		if err == io.EOF {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, err
+		}
+	}
+}
+
+// ParseEntries reads all the JSON log lines from r. If any lines could not be parsed the entries that could are
+// returned along with an error giving the number of lines skipped.
+func ParseEntries(r io.Reader) ([]Entry, error) {
+	entries := []Entry{}
+	skipped, err := ScanEntries(r, func(e Entry) {
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return entries, err
+	}
+	if skipped > 0 {
+		return entries, fmt.Errorf("sessionlogger: skipped %d malformed log lines", skipped)
+	}
+	return entries, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "log"
+import "time"
+import "bytes"
+import "reflect"
+import "strings"
+import "testing"
+import "encoding/json"
+
+func TestJSONOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).JSON(true).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, buf)
+	}
+	l := lc.NewSessionLoggerWithID("/api", "abc")
+
+	msgs := []string{
+		`plain`,
+		`say "hi" \ bye`,
+		"two\nlines\tand a tab",
+		"<b>&amp;</b> ünïcødé ✓",
+		"nul\x00 and bell\a",
+	}
+	for _, m := range msgs {
+		l.Warn(m)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(msgs) {
+		t.Fatalf("expected %d lines, got %d:\n%s", len(msgs), len(lines), buf.String())
+	}
+	for i, line := range lines {
+		e := Entry{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Errorf("line %q is not valid JSON: %v", line, err)
+			continue
+		}
+		if e.Msg != msgs[i] || e.Level != "warn" || e.ID != "abc" || e.Endpoint != "/api" || e.Caller != "" {
+			t.Errorf("line %d decoded to %+v", i, e)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, e.Time); err != nil {
+			t.Errorf("bad time in %q: %v", line, err)
+		}
+	}
+	if !strings.Contains(buf.String(), "<b>&amp;</b>") {
+		t.Errorf("HTML characters were escaped: %s", buf.String())
+	}
+}
+
+func TestJSONCaller(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).JSON(true).Flags(log.Lshortfile).Writer(Info, buf).LogSessionStart(false).NewMasterLogger()
+
+	l.Info("where: here")
+
+	e := Entry{}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(e.Caller, "json_test.go:") || e.Msg != "where: here" {
+		t.Errorf("decoded to %+v", e)
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).JSON(true).Flags(NoFlags).LogSessionStart(false).Sequenced(true)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, buf)
+	}
+	l := lc.NewSessionLoggerWithID("/api", "abc")
+	l.Info("first")
+	l.WithFields(map[string]any{"user": "bob", "n": 2}).Err("second")
+	buf.WriteString("\nnot json\n{\"level\":\n")
+	l.Warn("third")
+
+	entries, err := ParseEntries(bytes.NewReader(buf.Bytes()))
+	if err == nil || !strings.Contains(err.Error(), "skipped 2 malformed log lines") {
+		t.Errorf("error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("parsed %d entries, want 3: %+v", len(entries), entries)
+	}
+	for i, want := range []Entry{
+		{Level: "info", ID: "abc", Endpoint: "/api", Msg: "first"},
+		{Level: "err", ID: "abc", Endpoint: "/api", Msg: "second", Fields: map[string]any{"user": "bob", "n": 2.0}},
+		{Level: "warn", ID: "abc", Endpoint: "/api", Msg: "third"},
+	} {
+		got := entries[i]
+		got.Time = ""
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("entry %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	msgs := []string{}
+	skipped, err := ScanEntries(bytes.NewReader(buf.Bytes()), func(e Entry) { msgs = append(msgs, e.Msg) })
+	if skipped != 2 || err != nil || strings.Join(msgs, " ") != "first second third" {
+		t.Errorf("ScanEntries = %v, %v, saw %q", skipped, err, msgs)
+	}
+}
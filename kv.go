@@ -0,0 +1,98 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "log"
+
+// badKVKey is the key used for the last value of a key/value list with an odd length.
+const badKVKey = "!BADKV"
+
+// DebugKV writes msg to the debug log followed by the given key/value pairs, in the same format as fields from
+// WithFields (sorted key=value pairs, or the "fields" object in JSON mode). Keys should be strings, other keys are
+// formatted with fmt.Sprint. If kv has an odd length the last value gets the key "!BADKV". Error values are
+// written as their message.
+func (l *Logger) DebugKV(msg string, kv ...any) {
+	l.outputKV(Debug, msg, kv)
+}
+
+// InfoKV writes msg to the info log followed by the given key/value pairs, see DebugKV.
+func (l *Logger) InfoKV(msg string, kv ...any) {
+	l.outputKV(Info, msg, kv)
+}
+
+// WarnKV writes msg to the warning log followed by the given key/value pairs, see DebugKV.
+func (l *Logger) WarnKV(msg string, kv ...any) {
+	l.outputKV(Warn, msg, kv)
+}
+
+// ErrKV writes msg to the error log followed by the given key/value pairs, see DebugKV.
+func (l *Logger) ErrKV(msg string, kv ...any) {
+	l.outputKV(Err, msg, kv)
+}
+
+// outputKV does the work for the KV methods, it must be called directly by them.
+func (l *Logger) outputKV(lvl logLevel, msg string, kv []any) {
+	if !l.enabled(lvl) {
+		return
+	}
+	fields := kvFields(kv)
+
+	l.lock.Lock()
+	out, ll := l.out[lvl], *l.field(lvl)
+	l.lock.Unlock()
+
+	if jw, ok := out.(*jsonWriter); ok {
+		njw := *jw
+		njw.fields = mergeFields(jw.fields, fields)
+		log.New(&njw, ll.Prefix(), ll.Flags()).Output(3, msg)
+		return
+	}
+	l.output(lvl, 3, msg+formatFields(fields))
+}
+
+// kvFields turns a key/value list into a map.
+func kvFields(kv []any) map[string]any {
+	fields := make(map[string]any, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 == len(kv) {
+			fields[badKVKey] = kvValue(kv[i])
+			break
+		}
+
+		k, ok := kv[i].(string)
+		if !ok {
+			k = fmt.Sprint(kv[i])
+		}
+		fields[k] = kvValue(kv[i+1])
+	}
+	return fields
+}
+
+// kvValue converts errors to their message, since they have no useful JSON form.
+func kvValue(v any) any {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
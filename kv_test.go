@@ -0,0 +1,89 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "bytes"
+import "errors"
+import "testing"
+import "encoding/json"
+
+func TestKV(t *testing.T) {
+	cases := []struct {
+		name string
+		kv   []any
+		want string
+	}{
+		{"none", nil, "WARN@ep:abc: msg\n"},
+		{"even", []any{"user", "bob", "n", 3}, "WARN@ep:abc: msg n=3 user=bob\n"},
+		{"odd", []any{"user", "bob", "orphan"}, "WARN@ep:abc: msg !BADKV=orphan user=bob\n"},
+		{"one", []any{42}, "WARN@ep:abc: msg !BADKV=42\n"},
+		{"error", []any{"err", errors.New("no such file")}, `WARN@ep:abc: msg err="no such file"` + "\n"},
+		{"non-string key", []any{7, true}, "WARN@ep:abc: msg 7=true\n"},
+	}
+
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		l := (&Config{}).Writer(Warn, buf).Flags(NoFlags).LogSessionStart(false).NewSessionLoggerWithID("ep", "abc")
+		l.WarnKV("msg", c.kv...)
+		if buf.String() != c.want {
+			t.Errorf("%s: output %q, want %q", c.name, buf.String(), c.want)
+		}
+	}
+}
+
+func TestKVLevels(t *testing.T) {
+	var bufs [4]bytes.Buffer
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for lvl := range bufs {
+		lc.Writer(logLevel(lvl), &bufs[lvl])
+	}
+	l := lc.NewMasterLogger().WithFields(map[string]any{"a": 1})
+
+	l.DebugKV("d", "b", 2)
+	l.InfoKV("i", "c", "x y")
+	l.WarnKV("w")
+	l.ErrKV("e", "b", 2)
+
+	// Fields from the call come before the fields of the logger.
+	want := [4]string{"DBUG: d b=2 a=1\n", "INFO: i c=\"x y\" a=1\n", "WARN: w a=1\n", " ERR: e b=2 a=1\n"}
+	for lvl := range bufs {
+		if bufs[lvl].String() != want[lvl] {
+			t.Errorf("%v: %q, want %q", logLevel(lvl), bufs[lvl].String(), want[lvl])
+		}
+	}
+}
+
+func TestKVJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).JSON(true).Writer(Err, buf).LogSessionStart(false).NewSessionLoggerWithID("ep", "abc")
+	l.ErrKV("failed", "code", 500, "err", errors.New("boom"), "odd")
+
+	e := Entry{}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	f := e.Fields
+	if e.Msg != "failed" || e.ID != "abc" || f["code"] != 500.0 || f["err"] != "boom" || f["!BADKV"] != "odd" {
+		t.Errorf("decoded to %+v", e)
+	}
+}
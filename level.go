@@ -0,0 +1,107 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "errors"
+import "strconv"
+import "strings"
+
+// valid reports if the level is one of the level constants.
+func (l logLevel) valid() bool {
+	return l >= Debug && l <= Err
+}
+
+// mustBeValid panics if the level is not one of the level constants.
+func (l logLevel) mustBeValid() {
+	if !l.valid() {
+		panic("Log level " + strconv.Itoa(int(l)) + " out of range. Use the constants dumdum.")
+	}
+}
+
+// ParseLevel parses a level name, as is commonly read from a config file or environment variable. Accepted names
+// are "debug", "info", "warn" or "warning", and "err" or "error", in any case.
+func ParseLevel(s string) (logLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return Debug, nil
+	case "info":
+		return Info, nil
+	case "warn", "warning":
+		return Warn, nil
+	case "err", "error":
+		return Err, nil
+	}
+	return Info, errors.New("sessionlogger: unknown log level " + strconv.Quote(s))
+}
+
+// String returns the name of the level, as accepted by ParseLevel.
+func (l logLevel) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warn:
+		return "warn"
+	case Err:
+		return "err"
+	}
+	return "logLevel(" + strconv.Itoa(int(l)) + ")"
+}
+
+// SetMinLevel is a convenience method that disables every level below the given level. Levels at or above it
+// are left as they are. Will panic if the level is invalid.
+func (lc *Config) SetMinLevel(l logLevel) *Config {
+	l.mustBeValid()
+
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+
+	for i := Debug; i < l; i++ {
+		lc.Disabled[i] = true
+	}
+	return lc
+}
+
+// Set implements flag.Value, so a level can be used directly with flag.Var.
+func (l *logLevel) Set(s string) error {
+	v, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l logLevel) MarshalText() ([]byte, error) {
+	if !l.valid() {
+		return nil, errors.New("sessionlogger: invalid log level " + strconv.Itoa(int(l)))
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (l *logLevel) UnmarshalText(text []byte) error {
+	return l.Set(string(text))
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "flag"
+import "testing"
+import "encoding/json"
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		in   string
+		want logLevel
+	}{
+		{"debug", Debug},
+		{"DEBUG", Debug},
+		{"info", Info},
+		{" Info\n", Info},
+		{"warn", Warn},
+		{"Warning", Warn},
+		{"err", Err},
+		{"ERROR", Err},
+	}
+	for _, c := range cases {
+		got, err := ParseLevel(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", c.in, got, err, c.want)
+		}
+	}
+
+	for _, in := range []string{"", "verbose", "errors", "3", "in fo"} {
+		if got, err := ParseLevel(in); err == nil {
+			t.Errorf("ParseLevel(%q) = %v, expected an error", in, got)
+		}
+	}
+}
+
+func TestSetMinLevel(t *testing.T) {
+	lc := (&Config{}).Disable(Err).SetMinLevel(Warn)
+
+	want := [4]bool{Debug: true, Info: true, Warn: false, Err: true}
+	if lc.Disabled != want {
+		t.Errorf("Disabled = %v, want %v", lc.Disabled, want)
+	}
+
+	// A lower minimum does not turn anything back on.
+	lc.SetMinLevel(Debug)
+	if lc.Disabled != want {
+		t.Errorf("Disabled = %v after SetMinLevel(Debug), want %v", lc.Disabled, want)
+	}
+}
+
+func TestLevelFlag(t *testing.T) {
+	var lvl logLevel
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&lvl, "level", "minimum log level")
+
+	if err := fs.Parse([]string{"-level", "warning"}); err != nil || lvl != Warn {
+		t.Errorf("after -level warning: %v, %v", lvl, err)
+	}
+	if err := fs.Parse([]string{"-level", "loud"}); err == nil {
+		t.Errorf("bad level was accepted")
+	}
+	if lvl != Warn {
+		t.Errorf("bad level changed the value to %v", lvl)
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		b, err := json.Marshal(map[string]logLevel{"level": lvl})
+		if err != nil {
+			t.Fatalf("marshalling %v: %v", lvl, err)
+		}
+		if want := `{"level":"` + lvl.String() + `"}`; string(b) != want {
+			t.Errorf("marshalled %v as %s, want %s", lvl, b, want)
+		}
+
+		var back map[string]logLevel
+		if err := json.Unmarshal(b, &back); err != nil || back["level"] != lvl {
+			t.Errorf("round trip of %v gave %v, %v", lvl, back["level"], err)
+		}
+	}
+
+	if _, err := logLevel(7).MarshalText(); err == nil {
+		t.Errorf("invalid level was marshalled")
+	}
+	var lvl logLevel
+	if err := json.Unmarshal([]byte(`"chatty"`), &lvl); err == nil {
+		t.Errorf("unknown level name was unmarshalled as %v", lvl)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "sync"
+import "bytes"
+
+// defaultLineBufferSize is the buffer size used by NewLineBufferedWriter if the size given is not positive.
+const defaultLineBufferSize = 4096
+
+// LineBufferedWriter is an io.Writer that collects small writes into larger ones, but passes on every complete
+// line as soon as its line ending is written, so a file being tailed is never more than a partial line behind.
+// Anything after the last line ending is buffered until the line is finished, the buffer fills, or Flush is
+// called. It is safe for concurrent use.
+//
+// Config.Sync flushes it, and so does Config.Close.
+type LineBufferedWriter struct {
+	w    io.Writer
+	size int
+
+	lock sync.Mutex
+	buf  []byte
+}
+
+// NewLineBufferedWriter creates a LineBufferedWriter that writes to w, buffering up to size bytes of a partial
+// line. If size is 0 or less a default of 4096 is used.
+func NewLineBufferedWriter(w io.Writer, size int) *LineBufferedWriter {
+	if size <= 0 {
+		size = defaultLineBufferSize
+	}
+	return &LineBufferedWriter{w: w, size: size, buf: make([]byte, 0, size)}
+}
+
+// Write buffers p, and passes everything up to and including the last line ending in p on to the wrapped writer
+// as a single write. The rest is kept, unless that fills the buffer, in which case it is passed on as well. If
+// the wrapped writer fails the buffered data is thrown away.
+func (lw *LineBufferedWriter) Write(p []byte) (int, error) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+
+	rest := p
+	if i := bytes.LastIndexByte(p, '\n'); i >= 0 {
+		lines := p[:i+1]
+		if len(lw.buf) > 0 {
+			lines = append(lw.buf, lines...)
+		}
+		rest = p[i+1:]
+
+		lw.buf = lw.buf[:0]
+		_, err := lw.w.Write(lines)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	lw.buf = append(lw.buf, rest...)
+	if len(lw.buf) >= lw.size {
+		err := lw.flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush passes anything in the buffer on to the wrapped writer.
+func (lw *LineBufferedWriter) Flush() error {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+
+	return lw.flush()
+}
+
+// Close flushes the buffer. It does not close the wrapped writer.
+func (lw *LineBufferedWriter) Close() error {
+	return lw.Flush()
+}
+
+// flush must be called with the lock held.
+func (lw *LineBufferedWriter) flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+
+	_, err := lw.w.Write(lw.buf)
+	lw.buf = lw.buf[:0]
+	return err
+}
+
+func (lw *LineBufferedWriter) unwrap() []io.Writer {
+	return []io.Writer{lw.w}
+}
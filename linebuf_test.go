@@ -0,0 +1,92 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "testing"
+
+// writeRecorder records every write made to it separately.
+type writeRecorder struct {
+	writes []string
+}
+
+func (wr *writeRecorder) Write(p []byte) (int, error) {
+	wr.writes = append(wr.writes, string(p))
+	return len(p), nil
+}
+
+func TestLineBufferedWriter(t *testing.T) {
+	wr := &writeRecorder{}
+	lw := NewLineBufferedWriter(wr, 16)
+
+	steps := []struct {
+		write string
+		want  []string // All the writes passed on so far.
+	}{
+		{"par", nil},
+		{"tial", nil},
+		{" line\n", []string{"partial line\n"}},
+		{"one\ntwo\nthr", []string{"partial line\n", "one\ntwo\n"}},
+		{"ee\n", []string{"partial line\n", "one\ntwo\n", "three\n"}},
+		{"0123456789abcdef", []string{"partial line\n", "one\ntwo\n", "three\n", "0123456789abcdef"}},
+		{"a much longer line than the buffer\nand more\nleft", []string{
+			"partial line\n", "one\ntwo\n", "three\n", "0123456789abcdef",
+			"a much longer line than the buffer\nand more\n",
+		}},
+	}
+	for _, s := range steps {
+		n, err := lw.Write([]byte(s.write))
+		if n != len(s.write) || err != nil {
+			t.Fatalf("Write(%q) = %v, %v", s.write, n, err)
+		}
+		if fmt.Sprintf("%q", wr.writes) != fmt.Sprintf("%q", s.want) {
+			t.Errorf("after %q: writes %q, want %q", s.write, wr.writes, s.want)
+		}
+	}
+
+	if err := lw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if last := wr.writes[len(wr.writes)-1]; last != "left" {
+		t.Errorf("Flush wrote %q", last)
+	}
+	n := len(wr.writes)
+	lw.Flush()
+	if len(wr.writes) != n {
+		t.Errorf("Flush of an empty buffer wrote %q", wr.writes[n:])
+	}
+}
+
+func TestLineBufferedWriterSync(t *testing.T) {
+	wr := &writeRecorder{}
+	lw := NewLineBufferedWriter(wr, 0)
+	lc := (&Config{}).Writer(Info, lw)
+
+	lw.Write([]byte("no line ending"))
+	if err := lc.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(wr.writes) != 1 || wr.writes[0] != "no line ending" {
+		t.Errorf("Config.Sync did not flush: %q", wr.writes)
+	}
+}
@@ -20,7 +20,7 @@ misrepresented as being the original software.
 3. This notice may not be removed or altered from any source distribution.
 */
 
-// This package adds a "session logger", a log system that allows you to create loggers with three log levels, a
+// This package adds a "session logger", a log system that allows you to create loggers with four log levels, a
 // prefix, and a random unique ID that will be used to prefix every message. This makes it easy to tell where the
 // messages are coming from, if a request generates multiple log messages, etc.
 //
@@ -30,43 +30,108 @@ misrepresented as being the original software.
 // simple server applications, specifically in REST endpoints for low traffic server apps, chat bots, and other
 // endpoint or callback based microservices.
 //
-// Under the covers, logging is done by the standard library log package. No attempt is made to control log file
-// size outside of creating a new one every time the program is started.
+// Under the covers, logging is done by the standard library log package. By default a new log file is created
+// every time the program is started. RotatingWriter starts new files by size or time (and can compress the old
+// ones), PruneLogs and PruneLogsOlderThan remove old files, and Config.ReopenFile switches to a new file for use
+// with external log rotation tools.
 package sessionlogger
 
+import "io"
 import "os"
+import "fmt"
 import "log"
+import "sync"
 import "time"
+import "errors"
+import "strconv"
+import "runtime"
+import "strings"
+import "path/filepath"
+import "sync/atomic"
 
-import "github.com/teris-io/shortid"
+// exit is called by Fatal and Fatalf. It is a variable so it can be swapped out when testing.
+var exit = os.Exit
 
-var logIDService <-chan string
+// now is used to get the time when the config has no Clock. It is a variable so it can be swapped out when testing.
+var now = time.Now
 
-func init() {
-	go func() {
-		c := make(chan string)
-		logIDService = c
+// DefaultConfig is a simple global logger config that is used for NewMasterLogger and NewSessionLogger. Replace it
+// with SetDefaultConfig if there may be loggers being created at the same time.
+var DefaultConfig = &Config{}
 
-		idsource := shortid.MustNew(16, shortid.DefaultABC, uint64(time.Now().UnixNano()))
+var defaultConfigLock sync.RWMutex
 
-		for {
-			c <- idsource.MustGenerate()
-		}
-	}()
+// SetDefaultConfig replaces DefaultConfig, so code (such as libraries) using the package level constructors picks
+// up the settings of the application. It is safe to call while loggers are being created. Loggers created before
+// the change keep using the old config. If lc is nil a new zero config is used.
+func SetDefaultConfig(lc *Config) {
+	if lc == nil {
+		lc = &Config{}
+	}
+
+	defaultConfigLock.Lock()
+	defer defaultConfigLock.Unlock()
+
+	DefaultConfig = lc
 }
 
-// DefaultLoggerConfig is a simple global logger config that is used for NewMasterLogger and NewSessionLogger.
-var DefaultConfig = &Config{}
+// DefaultConfigSnapshot returns the current DefaultConfig. This is the config itself, not a copy, so changes made
+// to it with the builder methods are seen by loggers created from it later.
+func DefaultConfigSnapshot() *Config {
+	defaultConfigLock.RLock()
+	defer defaultConfigLock.RUnlock()
+
+	return DefaultConfig
+}
+
+// logFileLayout is the time layout used to name log files.
+const logFileLayout = "m01-d02-t150405"
 
 // CreateLogFile is a simple helper function for making log files. logdir should be a path to the directory you
-// want your log files to be placed in. If this path does not exist it will be created.
+// want your log files to be placed in. If this path does not exist it will be created, and an empty path is the
+// current directory. The file name is joined to the path with filepath.Join, so the path is cleaned.
+//
+// The file is named for the current time in UTC. Note that the times in the messages are local time unless the
+// log.LUTC flag is set (see Config.UTC), use CreateLogFileLocal to name the file in local time instead.
 func CreateLogFile(logdir string) (*os.File, error) {
-	err := os.MkdirAll(logdir, 0775)
+	return CreateLogFileWithFormat(logdir, logFileLayout+".log")
+}
+
+// CreateLogFileLocal is like CreateLogFile, but the file is named for the current local time.
+func CreateLogFileLocal(logdir string) (*os.File, error) {
+	return createLogFile(logdir, logFileLayout+".log", time.Now(), 0775, 0666)
+}
+
+// CreateLogFileWithFormat is like CreateLogFile, but the file name is the current UTC time formatted with the
+// given time layout, for example "2006-01-02_150405.log". The resulting name must have an extension and must not
+// contain path separators.
+func CreateLogFileWithFormat(logdir, layout string) (*os.File, error) {
+	return createLogFile(logdir, layout, time.Now().UTC(), 0775, 0666)
+}
+
+// CreateLogFileMode is like CreateLogFile, but the directory is created with dirMode and the file with fileMode
+// (CreateLogFile uses 0775 and 0666). As usual the umask is applied to both, and the modes only matter if the
+// directory or file is created, existing ones are not changed. On Windows the modes are mostly ignored.
+func CreateLogFileMode(logdir string, dirMode, fileMode os.FileMode) (*os.File, error) {
+	return createLogFile(logdir, logFileLayout+".log", time.Now().UTC(), dirMode, fileMode)
+}
+
+// createLogFile does the work for CreateLogFile and friends, naming the file by formatting t with layout.
+func createLogFile(logdir, layout string, t time.Time, dirMode, fileMode os.FileMode) (*os.File, error) {
+	name := t.Format(layout)
+	if strings.ContainsAny(name, `/\`) {
+		return nil, errors.New("sessionlogger: log file name " + strconv.Quote(name) + " contains a path separator")
+	}
+	if filepath.Ext(name) == "" {
+		return nil, errors.New("sessionlogger: log file name " + strconv.Quote(name) + " has no extension")
+	}
+
+	err := makeLogDir(logdir, dirMode)
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := os.Create(logdir + "/" + time.Now().UTC().Format("m01-d02-t150405") + ".log")
+	f, err := os.OpenFile(filepath.Join(logdir, name), os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileMode)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +139,14 @@ func CreateLogFile(logdir string) (*os.File, error) {
 	return f, nil
 }
 
+// makeLogDir creates logdir and any parents that do not exist. An empty path is the current directory.
+func makeLogDir(logdir string, mode os.FileMode) error {
+	if logdir == "" {
+		logdir = "."
+	}
+	return os.MkdirAll(logdir, mode)
+}
+
 // MustCreateLogFile is just CreateLogFile that panics on error.
 func MustCreateLogFile(logdir string) *os.File {
 	f, err := CreateLogFile(logdir)
@@ -83,47 +156,1005 @@ func MustCreateLogFile(logdir string) *os.File {
 	return f
 }
 
+// OpenLogFile opens the log file with the given name in logdir for appending, creating it (and the directory)
+// if needed. This is useful for short lived programs that run often, where a new file for every run would be
+// too much.
+func OpenLogFile(logdir, name string) (*os.File, error) {
+	err := makeLogDir(logdir, 0775)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(filepath.Join(logdir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+}
+
+// CreateLogFileExclusive creates a new log file with the given name in logdir (creating the directory if needed),
+// failing if the file already exists instead of truncating it. The error in that case is an os.ErrExist error
+// (check for it with errors.Is).
+func CreateLogFileExclusive(logdir, name string) (*os.File, error) {
+	err := makeLogDir(logdir, 0775)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(logdir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("sessionlogger: log file %v already exists: %w", strconv.Quote(name), err)
+	}
+	return f, err
+}
+
+// NewFileConfig is a helper that creates a log file in logdir (see CreateLogFile) and returns a config that writes
+// every level to both the file and the normal standard stream for that level. The file is also returned so it
+// can be closed (Close on the config works too).
+func NewFileConfig(logdir string) (*Config, *os.File, error) {
+	f, err := CreateLogFile(logdir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lc := &Config{}
+	for l := Debug; l <= Err; l++ {
+		lc.Writer(l, f, defaultWriters[l])
+	}
+	return lc, f, nil
+}
+
+// NewSplitFileConfig is like NewFileConfig, but errors and warnings get files of their own. Three files are created
+// in logdir, named like CreateLogFile names them plus "-info", "-warn", or "-err" (debug messages go in the info
+// file), and each level writes to its file and its normal standard stream. The returned function closes all
+// the files. If any of the files cannot be created the ones that were are closed again.
+func NewSplitFileConfig(logdir string) (*Config, func() error, error) {
+	files := []*os.File{}
+	closeAll := func() error {
+		var first error
+		for _, f := range files {
+			err := f.Close()
+			if err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+
+	for _, name := range []string{"info", "warn", "err"} {
+		f, err := CreateLogFileWithFormat(logdir, logFileLayout+"-"+name+".log")
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, f)
+	}
+
+	lc := &Config{}
+	lc.Writer(Debug, files[0], defaultWriters[Debug])
+	lc.Writer(Info, files[0], defaultWriters[Info])
+	lc.Writer(Warn, files[1], defaultWriters[Warn])
+	lc.Writer(Err, files[2], defaultWriters[Err])
+	return lc, closeAll, nil
+}
+
 // Logger is a logger instance. Possibly with a prefix and unique instance ID.
 type Logger struct {
-	// Info, Warning, and Error log levels.
-	I, W, E *log.Logger
+	// Debug, Info, Warning, and Error log levels.
+	D, I, W, E *log.Logger
 
-	// The unique ID string for this logger, or the string "MASTER" for a master logger.
+	// The unique ID string for this logger, or the string "MASTER" for a master logger without an ID. Use IsMaster
+	// to tell master loggers apart from session loggers.
+	//
+	// IDs from the default generator are unique within the process. IDs made with Config.IDLen are random, so a
+	// repeat is extremely unlikely but possible. IDs from IDGenerator, SetIDSource, or given to a constructor are
+	// only as unique as whatever made them. Derived loggers (from Sub, WithFields and so on) share the ID of the
+	// logger they came from, except for Clone.
 	ID string
+
+	endpoint string
+	master   bool
+	named    bool                 // A master logger with an ID given by the user, used in the prefix like a session ID.
+	extra    string               // Added to the prefix after the level token, see WithPrefix.
+	source   *Config              // The config the logger is registered with, if it is.
+	clones   *atomic.Uint64       // Number of clones made, for their IDs. Shared by loggers with the same ID.
+	tagged   map[string]io.Writer // Writers for Tagged, from the config. Never modified.
+	eachLine bool                 // See Config.PrefixEachLine.
+	format   prefixFormat         // See Config.PrefixFormat.
+	clock    func() time.Time     // Config.Clock.
+	flags    int                  // The flags of the config, for clockHeader.
+	json     bool                 // If the writers in out are jsonWriters (for JSON output or a Formatter).
+	tokens   [4]string            // Level tokens for the prefix of each level.
+	repanic  bool
+	dumps    bool
+
+	lock     sync.Mutex
+	out      [4]io.Writer // The real destination of each level, used while the level is enabled.
+	disabled [4]bool
+	muted    bool // Every level is discarded, see Mute.
 }
 
 // NewMasterLogger creates a new Logger without prefix or instance ID.
 func NewMasterLogger() *Logger {
-	return DefaultConfig.NewMasterLogger()
+	return DefaultConfigSnapshot().NewMasterLogger()
+}
+
+// NewMasterLoggerWithID creates a master Logger with a fixed ID that is used in the prefix of every message. See
+// Config.NewMasterLoggerWithID.
+func NewMasterLoggerWithID(id string) *Logger {
+	return DefaultConfigSnapshot().NewMasterLoggerWithID(id)
 }
 
 // NewSessionLogger creates a Logger that prefixes messages with the endpoint being logged and a unique
 // ID individual to that particular Logger.
 func NewSessionLogger(endpoint string) *Logger {
-	return DefaultConfig.NewSessionLogger(endpoint)
+	return mustLogger(DefaultConfigSnapshot().newSessionLogger(endpoint, ""))
+}
+
+// TryNewSessionLogger is NewSessionLogger, but if generating the session ID fails (including if a custom ID
+// generator panics) an error is returned instead of panicking.
+func TryNewSessionLogger(endpoint string) (*Logger, error) {
+	return DefaultConfigSnapshot().newSessionLogger(endpoint, "")
+}
+
+// NewSessionLoggerWithID creates a session Logger that uses the given ID instead of generating one, for IDs
+// that come from somewhere else, such as a trace ID. See Config.NewSessionLoggerWithID.
+func NewSessionLoggerWithID(endpoint, id string) *Logger {
+	return mustLogger(DefaultConfigSnapshot().newSessionLogger(endpoint, id))
 }
 
 // NewMasterLogger creates a new Logger without prefix or instance ID.
 func (lc *Config) NewMasterLogger() *Logger {
-	log := lc.newLogger("")
-	log.ID = "MASTER"
-	return log
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
+	return lc.newLogger("", "", true)
+}
+
+// NewMasterLoggerWithID creates a master Logger with a fixed ID, such as the host name, that is used in the
+// prefix of every message in the same way as the ID of a session logger. As it has no endpoint, the ID follows the
+// level after a space ("INFO web-3: ") until Sub gives it one. Unlike a session logger it does not write a message
+// when it is created and is never registered. If id is empty this is the same as NewMasterLogger.
+func (lc *Config) NewMasterLoggerWithID(id string) *Logger {
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
+	return lc.newLogger("", id, true)
 }
 
 // NewSessionLogger creates a Logger that prefixes messages with the endpoint being logged and a unique
 // ID individual to that particular Logger.
 func (lc *Config) NewSessionLogger(endpoint string) *Logger {
-	id := <-logIDService
-	log := lc.newLogger("@" + endpoint + ":" + id)
-	log.ID = id
-	log.I.Println("")
+	return mustLogger(lc.newSessionLogger(endpoint, ""))
+}
+
+// NewSessionLoggers creates a session logger for each of the given endpoints, each with its own ID, and returns
+// them keyed by endpoint. If an endpoint is given more than once only one logger is created for it.
+func (lc *Config) NewSessionLoggers(endpoints ...string) map[string]*Logger {
+	loggers := make(map[string]*Logger, len(endpoints))
+	for _, endpoint := range endpoints {
+		if _, ok := loggers[endpoint]; !ok {
+			loggers[endpoint] = mustLogger(lc.newSessionLogger(endpoint, ""))
+		}
+	}
+	return loggers
+}
+
+// TryNewSessionLogger is NewSessionLogger, but if generating the session ID fails (including if IDGenerator
+// panics or IDLength is out of range) an error is returned instead of panicking.
+func (lc *Config) TryNewSessionLogger(endpoint string) (*Logger, error) {
+	return lc.newSessionLogger(endpoint, "")
+}
+
+// NewSessionLoggerWithID creates a session Logger that uses the given ID instead of generating one, for IDs
+// that come from somewhere else, such as a trace ID or a request ID header. Since the ID may come from outside
+// the program, anything other than letters, digits, and "-_.+=~" is removed from it, and it is cut down to 64
+// bytes. If id is empty (or nothing is left of it) one is generated as usual.
+func (lc *Config) NewSessionLoggerWithID(endpoint, id string) *Logger {
+	return mustLogger(lc.newSessionLogger(endpoint, id))
+}
+
+// NewNopLogger creates a Logger that discards everything, with the ID "NOP". It does not get an ID from the
+// generator, is never registered, and does not depend on any config, so it is cheap to create.
+func NewNopLogger() *Logger {
+	l := &Logger{ID: "NOP", master: true, tokens: levelTokens, clones: &atomic.Uint64{}, format: defaultPrefixFormat}
+	for lvl := Debug; lvl <= Err; lvl++ {
+		l.out[lvl] = io.Discard
+		l.disabled[lvl] = true
+		*l.field(lvl) = log.New(io.Discard, "", 0)
+	}
+	return l
+}
+
+// newSessionLogger does the work for all the versions of NewSessionLogger. It must be called directly by them so
+// the session start message is attributed to the user's code. If id is empty one is generated, and the error
+// is only returned if that fails.
+func (lc *Config) newSessionLogger(endpoint, id string) (*Logger, error) {
+	id = sanitizeID(id)
+
+	lc.lock.RLock()
+	if id == "" {
+		var err error
+		id, err = lc.tryNewID()
+		if err != nil {
+			lc.lock.RUnlock()
+			return nil, err
+		}
+	}
+	log := lc.newLogger(endpoint, id, false)
+	reg, start := lc.Register, !lc.NoSessionStart
+	lc.lock.RUnlock()
+
+	if reg {
+		register(lc, log)
+	}
+	if start {
+		log.output(Info, 3, "")
+	}
+	return log, nil
+}
+
+// mustLogger panics if err is not nil.
+func mustLogger(l *Logger, err error) *Logger {
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// newLogger creates a logger with the given endpoint and ID. A master logger without an ID gets the ID "MASTER",
+// which is not used in the prefix. The lock must be held.
+func (lc *Config) newLogger(endpoint, id string, master bool) *Logger {
+	log := &Logger{
+		ID:       id,
+		endpoint: endpoint,
+		master:   master,
+		clones:   &atomic.Uint64{},
+		tagged:   lc.taggedWriters(),
+		eachLine: lc.eachLine,
+		format:   lc.prefixFormat(),
+		clock:    lc.Clock,
+		flags:    lc.flags(),
+		json:     lc.JSONOutput || lc.Formatter != nil,
+		tokens:   lc.tokens(),
+		repanic:  lc.Repanic,
+		dumps:    lc.StackDumps,
+	}
+	if master {
+		log.named = id != ""
+		if id == "" {
+			log.ID = "MASTER"
+		}
+	}
+
+	for l := Debug; l <= Err; l++ {
+		ll, w := lc.newLevelLogger(log, l)
+		log.out[l] = w
+		log.disabled[l] = lc.Disabled[l]
+		*log.field(l) = ll
+		log.apply(l)
+	}
 	return log
 }
 
-func (lc *Config) newLogger(prefix string) *Logger {
+// newLevelLogger creates the log.Logger for a level of l, and returns it along with the writer it uses.
+func (lc *Config) newLevelLogger(l *Logger, lvl logLevel) (*log.Logger, io.Writer) {
+	w := lc.destination(lvl)
+	flags := lc.flags()
+	if l.json {
+		flags &= log.Lshortfile | log.Llongfile | log.LUTC
+		if lc.Formatter != nil {
+			// Formatters are not given the caller, so don't pay for finding it.
+			flags &= log.LUTC
+		}
+		jw := &jsonWriter{
+			w:        w,
+			level:    lvl,
+			id:       l.ID,
+			endpoint: l.endpoint,
+			utc:      flags&log.LUTC != 0,
+			caller:   flags&(log.Lshortfile|log.Llongfile) != 0,
+			now:      lc.Clock,
+			format:   lc.Formatter,
+		}
+		return log.New(jw, l.prefix(lvl), flags), jw
+	}
+	if l.clock != nil {
+		// The header is written by output, see clockHeader.
+		flags = 0
+	}
+	return log.New(w, l.prefix(lvl), flags), w
+}
+
+// prefix returns the log.Logger prefix for a level. In JSON mode there is no prefix.
+func (l *Logger) prefix(lvl logLevel) string {
+	if l.json {
+		return ""
+	}
+
+	p := l.tokens[lvl]
+	if l.extra != "" {
+		p += " " + l.extra
+	}
+	f := l.format
+	switch {
+	case l.named && l.endpoint == "":
+		// A named master logger without an endpoint has nothing to put between the lead and the separator.
+		p += " " + l.ID
+	case !l.master || l.named:
+		p += f.lead + l.endpoint + f.sep + l.ID + f.end
+	case l.endpoint != "":
+		p += f.lead + l.endpoint + f.end
+	}
+	return p + ": "
+}
+
+// field returns a pointer to the field holding the log.Logger for the given level. l must be valid.
+func (l *Logger) field(lvl logLevel) **log.Logger {
+	switch lvl {
+	case Debug:
+		return &l.D
+	case Warn:
+		return &l.W
+	case Err:
+		return &l.E
+	}
+	return &l.I
+}
+
+// apply sets the output of the log.Logger for a level to match the logger's state. Must be called with the
+// lock held, or before the logger is shared.
+func (l *Logger) apply(lvl logLevel) {
+	if l.disabled[lvl] || l.muted {
+		(*l.field(lvl)).SetOutput(io.Discard)
+		return
+	}
+	(*l.field(lvl)).SetOutput(l.out[lvl])
+}
+
+// shell returns a new logger with the same ID, endpoint, and settings as l, but no log.Loggers or writers. Must be
+// called with the lock held.
+func (l *Logger) shell() *Logger {
 	return &Logger{
-		I: log.New(lc.GetWriter(Info), "INFO"+prefix+": ", log.Ldate|log.Ltime|log.Lshortfile),
-		W: log.New(lc.GetWriter(Warn), "WARN"+prefix+": ", log.Ldate|log.Ltime|log.Lshortfile),
-		E: log.New(lc.GetWriter(Err), " ERR"+prefix+": ", log.Ldate|log.Ltime|log.Lshortfile),
+		ID:       l.ID,
+		endpoint: l.endpoint,
+		master:   l.master,
+		named:    l.named,
+		extra:    l.extra,
+		clones:   l.clones,
+		tagged:   l.tagged,
+		eachLine: l.eachLine,
+		format:   l.format,
+		clock:    l.clock,
+		flags:    l.flags,
+		json:     l.json,
+		tokens:   l.tokens,
+		repanic:  l.repanic,
+		dumps:    l.dumps,
+		disabled: l.disabled,
+		muted:    l.muted,
+	}
+}
+
+// derive creates a copy of the logger with the same ID, prefixes, flags, and enabled levels. fn is called with
+// each level and its real destination, and returns the destination to use in the copy.
+func (l *Logger) derive(fn func(lvl logLevel, w io.Writer) io.Writer) *Logger {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	nl := l.shell()
+	for lvl := Debug; lvl <= Err; lvl++ {
+		ll := *l.field(lvl)
+		nl.out[lvl] = fn(lvl, l.out[lvl])
+		*nl.field(lvl) = log.New(nl.out[lvl], ll.Prefix(), ll.Flags())
+		nl.apply(lvl)
+	}
+	return nl
+}
+
+// WithWriter returns a derived logger that writes the given level to w instead of its normal destination. Other
+// levels, the ID, and the prefixes are unchanged, as is the original logger. Formatting done by the logger (JSON
+// output or fields from WithFields) is kept.
+func (l *Logger) WithWriter(level logLevel, w io.Writer) *Logger {
+	level.mustBeValid()
+
+	return l.derive(func(lvl logLevel, out io.Writer) io.Writer {
+		if lvl != level {
+			return out
+		}
+		return replaceDestination(out, w)
+	})
+}
+
+// replaceDestination returns a copy of out that writes to w, keeping any formatting writers from this package.
+func replaceDestination(out, w io.Writer) io.Writer {
+	switch out := out.(type) {
+	case *jsonWriter:
+		njw := *out
+		njw.w = replaceDestination(out.w, w)
+		return &njw
+	case *fieldsWriter:
+		nfw := *out
+		nfw.w = replaceDestination(out.w, w)
+		return &nfw
+	}
+	return w
+}
+
+// baseDestination returns the writer under any formatting writers from this package in out.
+func baseDestination(out io.Writer) io.Writer {
+	switch out := out.(type) {
+	case *jsonWriter:
+		return baseDestination(out.w)
+	case *fieldsWriter:
+		return baseDestination(out.w)
+	}
+	return out
+}
+
+// Writer returns an io.Writer that writes directly to the destination of the given level, for use with code that
+// wants an io.Writer for its own output. Writes through it do not get the level prefix (or JSON formatting, or
+// fields), they are passed on exactly as given, so make sure each write is a complete line. Writes are dropped
+// while the level is disabled.
+func (l *Logger) Writer(level logLevel) io.Writer {
+	level.mustBeValid()
+
+	return &levelWriter{l: l, level: level}
+}
+
+type levelWriter struct {
+	l     *Logger
+	level logLevel
+}
+
+func (lw *levelWriter) Write(p []byte) (int, error) {
+	lw.l.lock.Lock()
+	disabled, out := lw.l.disabled[lw.level] || lw.l.muted, lw.l.out[lw.level]
+	lw.l.lock.Unlock()
+
+	if disabled {
+		return len(p), nil
+	}
+	return baseDestination(out).Write(p)
+}
+
+// Tee makes every level of the logger also write to w, in addition to the normal destinations, until the
+// returned function is called. Only this logger (and loggers derived from it while the tee is in place) are
+// affected. Messages are written to w in the same format as to the normal destination, and errors from w are
+// ignored so a broken tee does not effect normal logging. Disabled levels are not written to w.
+func (l *Logger) Tee(w io.Writer) (undo func()) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	tees := [4]*teeWriter{}
+	for lvl := Debug; lvl <= Err; lvl++ {
+		tees[lvl] = &teeWriter{w: baseDestination(l.out[lvl]), extra: w}
+		l.out[lvl] = replaceDestination(l.out[lvl], tees[lvl])
+		l.apply(lvl)
+	}
+
+	return func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		for lvl := Debug; lvl <= Err; lvl++ {
+			tees[lvl].removed.Store(true)
+
+			// If nothing was stacked on top of the tee, take it out completely.
+			if baseDestination(l.out[lvl]) == io.Writer(tees[lvl]) {
+				l.out[lvl] = replaceDestination(l.out[lvl], tees[lvl].w)
+				l.apply(lvl)
+			}
+		}
+	}
+}
+
+// teeWriter writes to w, and also extra until it is removed.
+type teeWriter struct {
+	w       io.Writer
+	extra   io.Writer
+	removed atomic.Bool
+}
+
+func (tw *teeWriter) Write(p []byte) (int, error) {
+	n, err := tw.w.Write(p)
+	if !tw.removed.Load() {
+		tw.extra.Write(p)
+	}
+	return n, err
+}
+
+func (tw *teeWriter) unwrap() []io.Writer {
+	return []io.Writer{tw.w, tw.extra}
+}
+
+// Sub returns a derived logger for a part of the work this logger is doing, such as a phase of handling a
+// request. The derived logger has the same ID and writers, but the endpoint is extended with the given name, so
+// "@parent:id" becomes "@parent/child:id".
+func (l *Logger) Sub(endpoint string) *Logger {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.endpoint != "" {
+		endpoint = l.endpoint + "/" + endpoint
+	}
+
+	nl := l.shell()
+	nl.endpoint = endpoint
+	return l.rebuild(nl, func(jw *jsonWriter) {
+		jw.endpoint = endpoint
+	})
+}
+
+// rebuild sets up the levels of nl, a shell of l with changes to the ID, endpoint, or prefix, using the
+// destinations of l. fn is called with a copy of each jsonWriter (in JSON mode) so it can be changed to match.
+// Must be called with the lock of l held.
+func (l *Logger) rebuild(nl *Logger, fn func(jw *jsonWriter)) *Logger {
+	for lvl := Debug; lvl <= Err; lvl++ {
+		ll := *l.field(lvl)
+		nl.out[lvl] = l.out[lvl]
+		if jw, ok := nl.out[lvl].(*jsonWriter); ok {
+			njw := *jw
+			fn(&njw)
+			nl.out[lvl] = &njw
+		}
+		*nl.field(lvl) = log.New(nl.out[lvl], nl.prefix(lvl), ll.Flags())
+		nl.apply(lvl)
+	}
+	return nl
+}
+
+// WithPrefix returns a derived logger that adds extra to the prefix of every level, for things like a tenant or
+// region. It goes right after the level token, separated by a space, and before the endpoint and ID, so a
+// message looks like "INFO extra@endpoint:id: ...". Calling WithPrefix on a derived logger adds to the existing
+// extra prefix, also separated by a space. In JSON mode the extra prefix is written as the field "prefix".
+func (l *Logger) WithPrefix(extra string) *Logger {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	nl := l.shell()
+	if nl.extra != "" {
+		extra = nl.extra + " " + extra
+	}
+	nl.extra = extra
+	return l.rebuild(nl, func(jw *jsonWriter) {
+		jw.fields = mergeFields(jw.fields, map[string]any{"prefix": extra})
+	})
+}
+
+// Tagged returns a derived logger that writes every message to the writers for the given routing tags (see
+// Config.TagWriter) as well as to the normal destination for the level. Tags with no writers in the config the
+// logger was created from are ignored. Messages are written to the tag writers in the same format as to the
+// normal destination.
+func (l *Logger) Tagged(tags ...string) *Logger {
+	extra := []io.Writer{}
+	for _, tag := range tags {
+		if w, ok := l.tagged[tag]; ok {
+			extra = append(extra, w)
+		}
+	}
+
+	return l.derive(func(_ logLevel, out io.Writer) io.Writer {
+		if len(extra) == 0 {
+			return out
+		}
+		return replaceDestination(out, newMultiWriter(append([]io.Writer{baseDestination(out)}, extra...)...))
+	})
+}
+
+// Clone returns a derived logger for work done in parallel with this logger, such as one of several workers
+// started by a request. It has the same endpoint, prefixes, and writers, but a new ID made from this logger's
+// ID and a counter, so the first clone of "abc" is "abc.1", the second "abc.2", and so on. Clones of a master
+// logger show their ID in the prefix, like a session logger.
+func (l *Logger) Clone() *Logger {
+	id := l.ID + "." + strconv.FormatUint(l.clones.Add(1), 10)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	nl := l.shell()
+	nl.ID = id
+	nl.named = nl.master
+	nl.clones = &atomic.Uint64{}
+	return l.rebuild(nl, func(jw *jsonWriter) {
+		jw.id = id
+	})
+}
+
+// SetLevelEnabled turns a level of this logger on or off, regardless of the config it was created from. Turning
+// a level on that was disabled in the config makes it write to the writer the config would have used. It is
+// safe to call this while the logger is in use by other goroutines.
+func (l *Logger) SetLevelEnabled(level logLevel, enabled bool) {
+	level.mustBeValid()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.disabled[level] = !enabled
+	l.apply(level)
+}
+
+// WithTemporaryLevel is SetLevelEnabled, but it returns a function that puts the level back the way it was, for
+// turning a level on (or off) for part of the code:
+//
+//	defer l.WithTemporaryLevel(sessionlogger.Debug, true)()
+//
+// Nested changes are undone correctly as long as the restore functions are called in the reverse order, as
+// with defer. Calling a restore function more than once does nothing. Mute still silences the level while the
+// change is in effect.
+func (l *Logger) WithTemporaryLevel(level logLevel, enabled bool) (restore func()) {
+	level.mustBeValid()
+
+	l.lock.Lock()
+	was := !l.disabled[level]
+	l.disabled[level] = !enabled
+	l.apply(level)
+	l.lock.Unlock()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { l.SetLevelEnabled(level, was) })
+	}
+}
+
+// Mute silences every level of this logger until Unmute is called, without changing which levels are enabled
+// (SetLevelEnabled still works while muted, and takes effect on Unmute). Muting a muted logger does nothing.
+// Loggers derived from this one while it is muted start out muted, but are not changed by later calls. It is
+// safe to call this while the logger is in use by other goroutines.
+func (l *Logger) Mute() {
+	l.setMuted(true)
+}
+
+// Unmute undoes Mute, so every level that is enabled writes to its destination again.
+func (l *Logger) Unmute() {
+	l.setMuted(false)
+}
+
+func (l *Logger) setMuted(muted bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.muted = muted
+	for lvl := Debug; lvl <= Err; lvl++ {
+		l.apply(lvl)
+	}
+}
+
+// SetOutput changes the destination of a level of this logger to w, like log.SetOutput. Unlike WithWriter the
+// logger itself is changed, but loggers already derived from it are not. Formatting done by the logger (JSON
+// output or fields from WithFields) is kept, and if the level is disabled w is used once it is enabled. It is
+// safe to call this while the logger is in use by other goroutines.
+func (l *Logger) SetOutput(level logLevel, w io.Writer) {
+	level.mustBeValid()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.out[level] = replaceDestination(l.out[level], w)
+	l.apply(level)
+}
+
+// output writes a message to a level. calldepth is used like the argument to log.Logger.Output, counting from the
+// caller of output.
+func (l *Logger) output(lvl logLevel, calldepth int, msg string) error {
+	if l.eachLine && !l.json {
+		msg = l.prefixLines(lvl, msg)
+	}
+	if l.clock != nil && !l.json {
+		msg = l.clockHeader(calldepth+1) + msg
+	}
+	return (*l.field(lvl)).Output(calldepth+1, msg)
+}
+
+// outputPC is output for messages where the code that logged them is already known, such as slog records. pc
+// is a program counter in that code, or 0 if it is not known.
+func (l *Logger) outputPC(lvl logLevel, pc uintptr, msg string) error {
+	file, line := "???", 0
+	if pc != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		file, line = frame.File, frame.Line
+	}
+	return l.outputAt(lvl, file, line, msg)
+}
+
+// outputAt is outputPC for a file and line that are already known.
+func (l *Logger) outputAt(lvl logLevel, file string, line int, msg string) error {
+	if l.eachLine && !l.json {
+		msg = l.prefixLines(lvl, msg)
+	}
+
+	ll := *l.field(lvl)
+	if l.clock != nil && !l.json {
+		return ll.Output(1, l.clockHeaderAt(file, line)+msg)
+	}
+	flags := ll.Flags()
+	if flags&(log.Lshortfile|log.Llongfile) == 0 {
+		return ll.Output(1, msg)
+	}
+
+	// The log package can only find the file from the stack, so add it to the message ourselves and write with a
+	// copy of the log.Logger without the file flags.
+	prefix, caller := ll.Prefix(), string(appendCaller(nil, flags, file, line))
+	if flags&log.Lmsgprefix != 0 {
+		msg, prefix = caller+prefix+msg, ""
+	} else {
+		msg = caller + msg
+	}
+	return log.New(ll.Writer(), prefix, flags&^(log.Lshortfile|log.Llongfile)).Output(1, msg)
+}
+
+// prefixLines adds the prefix for the level to every line of msg after the first (the log package adds it to
+// the first). A line ending at the end of msg is ignored.
+func (l *Logger) prefixLines(lvl logLevel, msg string) string {
+	msg = strings.TrimSuffix(msg, "\n")
+	if !strings.Contains(msg, "\n") {
+		return msg
+	}
+	return strings.ReplaceAll(msg, "\n", "\n"+(*l.field(lvl)).Prefix())
+}
+
+// enabled reports if a level is currently enabled. l must be valid.
+func (l *Logger) enabled(lvl logLevel) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return !l.disabled[lvl] && !l.muted
+}
+
+// Endpoint returns the endpoint of the logger, as given to the constructor (or extended with Sub), without any of
+// the decoration it gets in the prefix. It is empty for master loggers created without one.
+func (l *Logger) Endpoint() string {
+	return l.endpoint
+}
+
+// SameSession reports if l and other log for the same session, meaning they have the same ID and endpoint, and are
+// both session loggers or both master loggers. Loggers derived with WithFields, WithPrefix, Tagged, and the like
+// are the same session as the original, while ones from Sub (a different endpoint) and Clone (a different ID)
+// are not. A nil logger is only the same session as another nil logger.
+func (l *Logger) SameSession(other *Logger) bool {
+	if l == nil || other == nil {
+		return l == other
+	}
+	return l.ID == other.ID && l.endpoint == other.endpoint && l.master == other.master
+}
+
+// IsMaster reports if the logger is a master logger (including ones with an ID, and the nop logger) rather than
+// a session logger. Loggers derived from a logger, such as with Sub or Clone, are the same kind as their parent.
+// Use this rather than comparing the ID to "MASTER".
+func (l *Logger) IsMaster() bool {
+	return l.master
+}
+
+// DebugEnabled reports if the debug level is enabled, for skipping expensive work to build a message that would
+// be thrown away. The check is cheap and does not allocate.
+func (l *Logger) DebugEnabled() bool {
+	return l.enabled(Debug)
+}
+
+// InfoEnabled reports if the info level is enabled.
+func (l *Logger) InfoEnabled() bool {
+	return l.enabled(Info)
+}
+
+// WarnEnabled reports if the warning level is enabled.
+func (l *Logger) WarnEnabled() bool {
+	return l.enabled(Warn)
+}
+
+// ErrEnabled reports if the error level is enabled.
+func (l *Logger) ErrEnabled() bool {
+	return l.enabled(Err)
+}
+
+// Sync flushes or syncs the writers used by this logger, in the same way as Config.Sync.
+func (l *Logger) Sync() error {
+	l.lock.Lock()
+	out := l.out
+	l.lock.Unlock()
+
+	return syncWriters(out[:]...)
+}
+
+// Debug writes a message to the debug log, formatted in the manner of fmt.Sprint. If the level is disabled the
+// message is not formatted at all, which is true of all the methods like this.
+//
+// Calling this method (rather than l.D.Print) is not required to get the right source file and line in the
+// output, but helpers that wrap a Logger should use these methods or call Output with the right depth.
+func (l *Logger) Debug(v ...any) {
+	if !l.enabled(Debug) {
+		return
+	}
+	l.output(Debug, 2, fmt.Sprint(v...))
+}
+
+// Info writes a message to the info log, formatted in the manner of fmt.Sprint.
+func (l *Logger) Info(v ...any) {
+	if !l.enabled(Info) {
+		return
 	}
+	l.output(Info, 2, fmt.Sprint(v...))
+}
+
+// Warn writes a message to the warning log, formatted in the manner of fmt.Sprint.
+func (l *Logger) Warn(v ...any) {
+	if !l.enabled(Warn) {
+		return
+	}
+	l.output(Warn, 2, fmt.Sprint(v...))
+}
+
+// Err writes a message to the error log, formatted in the manner of fmt.Sprint.
+func (l *Logger) Err(v ...any) {
+	if !l.enabled(Err) {
+		return
+	}
+	l.output(Err, 2, fmt.Sprint(v...))
+}
+
+// Debugf writes a message to the debug log, formatted in the manner of fmt.Sprintf.
+func (l *Logger) Debugf(format string, v ...any) {
+	if !l.enabled(Debug) {
+		return
+	}
+	l.output(Debug, 2, fmt.Sprintf(format, v...))
+}
+
+// Infof writes a message to the info log, formatted in the manner of fmt.Sprintf.
+func (l *Logger) Infof(format string, v ...any) {
+	if !l.enabled(Info) {
+		return
+	}
+	l.output(Info, 2, fmt.Sprintf(format, v...))
+}
+
+// Warnf writes a message to the warning log, formatted in the manner of fmt.Sprintf.
+func (l *Logger) Warnf(format string, v ...any) {
+	if !l.enabled(Warn) {
+		return
+	}
+	l.output(Warn, 2, fmt.Sprintf(format, v...))
+}
+
+// Errf writes a message to the error log, formatted in the manner of fmt.Sprintf.
+func (l *Logger) Errf(format string, v ...any) {
+	if !l.enabled(Err) {
+		return
+	}
+	l.output(Err, 2, fmt.Sprintf(format, v...))
+}
+
+// Log writes a message to the given level, formatted in the manner of fmt.Sprintf, for code that picks the level
+// at run time. Invalid levels are treated as info rather than panicking, since the level is likely to come from
+// outside the program.
+func (l *Logger) Log(level logLevel, format string, v ...any) {
+	if !level.valid() {
+		level = Info
+	}
+	if !l.enabled(level) {
+		return
+	}
+	l.output(level, 2, fmt.Sprintf(format, v...))
+}
+
+// Logln is Log formatted in the manner of fmt.Sprintln.
+func (l *Logger) Logln(level logLevel, v ...any) {
+	if !level.valid() {
+		level = Info
+	}
+	if !l.enabled(level) {
+		return
+	}
+	l.output(level, 2, fmt.Sprintln(v...))
+}
+
+// Timer starts timing something, and returns a function that writes "name took <duration>" to the info log when
+// it is called, so timing a function is as simple as:
+//
+//	defer l.Timer("loading the user")()
+//
+// If a threshold is given and the duration is longer than it, the message goes to the warning log instead, with
+// the threshold added to the end. Only the first threshold is used.
+func (l *Logger) Timer(name string, threshold ...time.Duration) func() {
+	start := l.now()
+	return func() {
+		d := l.now().Sub(start)
+		if len(threshold) > 0 && d > threshold[0] {
+			l.output(Warn, 2, fmt.Sprintf("%v took %v (more than %v)", name, d, threshold[0]))
+			return
+		}
+		l.output(Info, 2, fmt.Sprintf("%v took %v", name, d))
+	}
+}
+
+// Heartbeat starts a goroutine that writes a "still alive" message with the logger ID and a count to the info log
+// every interval, for liveness monitoring. The returned function stops the heartbeat, and does not return until
+// the goroutine has exited. Calling it more than once is harmless. Panics if interval is not positive.
+func (l *Logger) Heartbeat(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		panic("sessionlogger: Heartbeat interval must be positive, not " + interval.String() + ".")
+	}
+
+	ticker := time.NewTicker(interval)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+
+		for n := 1; ; n++ {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				l.output(Info, 1, fmt.Sprintf("still alive (%v, heartbeat %d)", l.ID, n))
+			}
+		}
+	}()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { close(quit) })
+		<-done
+	}
+}
+
+// LogError writes "msg: err" to the error log, unless err is nil in which case nothing is written. This makes it
+// easy to log errors that may or may not have happened:
+//
+//	l.LogError("closing the connection failed", conn.Close())
+func (l *Logger) LogError(msg string, err error) {
+	if err == nil || !l.enabled(Err) {
+		return
+	}
+	l.output(Err, 2, msg+": "+err.Error())
+}
+
+// ErrWithStacks writes msg to the error log, followed by a dump of the stacks of all goroutines if StackDumps was
+// set in the config, for errors bad enough to need a post-mortem. Without StackDumps it is the same as Err.
+func (l *Logger) ErrWithStacks(msg string) {
+	if !l.enabled(Err) {
+		return
+	}
+	if l.dumps {
+		msg += "\n" + string(allStacks())
+	}
+	l.output(Err, 2, msg)
+}
+
+// allStacks returns the stacks of all goroutines, as formatted by runtime.Stack.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+// Fatal writes a message to the error log (formatted in the manner of fmt.Sprint) and then calls os.Exit(1).
+// The program will exit even if the error level is disabled.
+func (l *Logger) Fatal(v ...any) {
+	l.output(Err, 2, fmt.Sprint(v...))
+	exit(1)
+}
+
+// Fatalf writes a message to the error log (formatted in the manner of fmt.Sprintf) and then calls os.Exit(1).
+// The program will exit even if the error level is disabled.
+func (l *Logger) Fatalf(format string, v ...any) {
+	l.output(Err, 2, fmt.Sprintf(format, v...))
+	exit(1)
+}
+
+// Panic writes a message to the error log (formatted in the manner of fmt.Sprint) and then panics with the
+// same message.
+func (l *Logger) Panic(v ...any) {
+	s := fmt.Sprint(v...)
+	l.output(Err, 2, s)
+	panic(s)
+}
+
+// Panicf writes a message to the error log (formatted in the manner of fmt.Sprintf) and then panics with
+// the same message.
+func (l *Logger) Panicf(format string, v ...any) {
+	s := fmt.Sprintf(format, v...)
+	l.output(Err, 2, s)
+	panic(s)
 }
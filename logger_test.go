@@ -0,0 +1,1317 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "fmt"
+import "log"
+import "time"
+import "errors"
+import "bytes"
+import "sync"
+import "strings"
+import "runtime"
+import "path/filepath"
+import "encoding/json"
+import "testing"
+
+// catchExit replaces exit for the rest of the test, and returns a pointer to the last code it was called with (-1
+// if it was not called).
+func catchExit(t *testing.T) *int {
+	t.Helper()
+
+	code := -1
+	old := exit
+	exit = func(c int) { code = c }
+	t.Cleanup(func() { exit = old })
+	return &code
+}
+
+func TestFatal(t *testing.T) {
+	code := catchExit(t)
+
+	buf := &bytes.Buffer{}
+	l := (&Config{}).Writer(Err, buf).Flags(NoFlags).NewMasterLogger()
+	l.Fatal("out of ", "cheese")
+
+	if *code != 1 {
+		t.Errorf("exit code = %v, want 1", *code)
+	}
+	if got := buf.String(); got != " ERR: out of cheese\n" {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestFatalfWhenDisabled(t *testing.T) {
+	code := catchExit(t)
+
+	buf := &bytes.Buffer{}
+	l := (&Config{}).Writer(Err, buf).Disable(Err).NewMasterLogger()
+	l.Fatalf("code %d", 42)
+
+	if *code != 1 {
+		t.Errorf("exit code = %v, want 1", *code)
+	}
+	if strings.Contains(buf.String(), "code 42") {
+		t.Errorf("disabled level was written to: %q", buf.String())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).Writer(Err, buf).Flags(NoFlags).NewMasterLogger()
+
+	cases := []struct {
+		name string
+		fn   func()
+	}{
+		{"Panic", func() { l.Panic("out of ", "cheese") }},
+		{"Panicf", func() { l.Panicf("out of %s", "cheese") }},
+	}
+	for _, c := range cases {
+		buf.Reset()
+		func() {
+			defer func() {
+				if r := recover(); r != "out of cheese" {
+					t.Errorf("%s: recovered %#v", c.name, r)
+				}
+			}()
+			c.fn()
+		}()
+		if got := buf.String(); got != " ERR: out of cheese\n" {
+			t.Errorf("%s: output = %q", c.name, got)
+		}
+	}
+}
+
+// line returns the line it was called from, so a test can log and record its position in a single line.
+func line() int {
+	_, _, n, _ := runtime.Caller(1)
+	return n
+}
+
+func TestCallerLocation(t *testing.T) {
+	catchExit(t)
+
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Flags(log.Lshortfile).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, buf)
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	cases := []struct {
+		name string
+		log  func() int
+	}{
+		{"Debug", func() int { l.Debug("x"); return line() }},
+		{"Info", func() int { l.Info("x"); return line() }},
+		{"Warn", func() int { l.Warn("x"); return line() }},
+		{"Err", func() int { l.Err("x"); return line() }},
+		{"Debugf", func() int { l.Debugf("%v", 1); return line() }},
+		{"Infof", func() int { l.Infof("%v", 1); return line() }},
+		{"Warnf", func() int { l.Warnf("%v", 1); return line() }},
+		{"Errf", func() int { l.Errf("%v", 1); return line() }},
+		{"Log", func() int { l.Log(Warn, "%v", 1); return line() }},
+		{"Logln", func() int { l.Logln(Warn, 1); return line() }},
+		{"LogError", func() int { l.LogError("x", io.EOF); return line() }},
+		{"InfoKV", func() int { l.InfoKV("x", "k", 1); return line() }},
+		{"Fatal", func() int { l.Fatal("x"); return line() }},
+		{"Fatalf", func() int { l.Fatalf("%v", 1); return line() }},
+		{"Panic", func() (n int) {
+			defer func() { recover() }()
+			n = line() + 1
+			l.Panic("x")
+			return
+		}},
+	}
+
+	for _, c := range cases {
+		buf.Reset()
+		want := fmt.Sprintf("logger_test.go:%d: ", c.log())
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%s: output %q does not contain %q", c.name, buf.String(), want)
+		}
+	}
+}
+
+// swapStdStreams replaces the default writers with buffers for the rest of the test, so configs that write to
+// stdout and stderr as well as a file can be checked.
+func swapStdStreams(t *testing.T) (stdout, stderr *bytes.Buffer) {
+	t.Helper()
+
+	old := defaultWriters
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	defaultWriters = []io.Writer{stdout, stdout, stdout, stderr}
+	t.Cleanup(func() { defaultWriters = old })
+	return stdout, stderr
+}
+
+func TestNewFileConfig(t *testing.T) {
+	stdout, stderr := swapStdStreams(t)
+
+	lc, f, err := NewFileConfig(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc.Flags(NoFlags).LogSessionStart(false)
+
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+	l.Info("one")
+	l.Warn("two")
+	l.Err("three")
+	if err := lc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "INFO@ep:abc: one\nWARN@ep:abc: two\n ERR@ep:abc: three\n"; string(b) != want {
+		t.Errorf("file contains %q, want %q", b, want)
+	}
+	if want := "INFO@ep:abc: one\nWARN@ep:abc: two\n"; stdout.String() != want {
+		t.Errorf("stdout got %q, want %q", stdout.String(), want)
+	}
+	if want := " ERR@ep:abc: three\n"; stderr.String() != want {
+		t.Errorf("stderr got %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestOpenLogFileAppends(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "new", "dir")
+
+	for _, line := range []string{"first run\n", "second run\n"} {
+		f, err := OpenLogFile(dir, "app.log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(line)
+		f.Close()
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first run\nsecond run\n" {
+		t.Errorf("file contains %q", b)
+	}
+}
+
+func TestCreateLogFileWithFormat(t *testing.T) {
+	dir := t.TempDir()
+	const layout = "2006-01-02_150405.log"
+
+	before := time.Now().UTC().Truncate(time.Second)
+	f, err := CreateLogFileWithFormat(dir, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	after := time.Now().UTC()
+
+	if filepath.Dir(f.Name()) != dir {
+		t.Errorf("file %q is not in %q", f.Name(), dir)
+	}
+	named, err := time.Parse(layout, filepath.Base(f.Name()))
+	if err != nil {
+		t.Fatalf("file name %q does not match the layout: %v", f.Name(), err)
+	}
+	if named.Before(before) || named.After(after) {
+		t.Errorf("file is named for %v, which is not between %v and %v", named, before, after)
+	}
+}
+
+func TestCreateLogFileWithFormatBadNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, layout := range []string{"2006-01-02", "2006/01/02.log", `2006\01.log`, "../15.log"} {
+		if f, err := CreateLogFileWithFormat(dir, layout); err == nil {
+			f.Close()
+			t.Errorf("layout %q was accepted, made %q", layout, f.Name())
+		}
+	}
+}
+
+func TestSetLevelEnabled(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Writer(Debug, cw).Disable(Debug).Flags(NoFlags).LogSessionStart(false)
+	l := lc.NewMasterLogger()
+	other := lc.NewMasterLogger()
+
+	l.Info("1")
+	l.SetLevelEnabled(Info, false)
+	l.Info("2")
+	other.Info("3") // Other loggers from the config are not affected.
+	l.SetLevelEnabled(Info, true)
+	l.Info("4")
+
+	// Debug is disabled in the config, but can still be turned on.
+	l.Debug("5")
+	l.SetLevelEnabled(Debug, true)
+	l.Debug("6")
+
+	want := []string{"INFO: 1", "INFO: 3", "INFO: 4", "DBUG: 6"}
+	if got := cw.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestSetLevelEnabledConcurrent(t *testing.T) {
+	cw := &CaptureWriter{}
+	l := (&Config{}).Writer(Warn, cw).Flags(NoFlags).LogSessionStart(false).NewMasterLogger()
+
+	stop := make(chan struct{})
+	toggled := make(chan struct{})
+	go func() {
+		defer close(toggled)
+		for on := false; ; on = !on {
+			select {
+			case <-stop:
+				l.SetLevelEnabled(Warn, true)
+				return
+			default:
+				l.SetLevelEnabled(Warn, on)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				l.Warn("flicker")
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-toggled
+
+	for _, line := range cw.Lines() {
+		if line != "WARN: flicker" {
+			t.Fatalf("mangled line %q", line)
+		}
+	}
+	cw.Reset()
+	l.Warn("on")
+	if cw.String() != "WARN: on\n" {
+		t.Errorf("level not enabled at the end, got %q", cw.String())
+	}
+}
+
+func TestSub(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Flags(NoFlags).LogSessionStart(false)
+	l := lc.NewSessionLoggerWithID("/api", "abc")
+
+	child := l.Sub("auth")
+	grandchild := child.Sub("token")
+	if child.ID != l.ID || grandchild.ID != l.ID {
+		t.Errorf("IDs changed: %q, %q, %q", l.ID, child.ID, grandchild.ID)
+	}
+	if grandchild.Endpoint() != "/api/auth/token" {
+		t.Errorf("Endpoint() = %q", grandchild.Endpoint())
+	}
+
+	grandchild.Info("deep")
+	child.Info("middle")
+	l.Info("top")
+
+	want := []string{"INFO@/api/auth/token:abc: deep", "INFO@/api/auth:abc: middle", "INFO@/api:abc: top"}
+	if got := cw.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestSubJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).JSON(true).Writer(Info, buf).LogSessionStart(false).NewSessionLoggerWithID("a", "abc")
+	l.Sub("b").Sub("c").Info("x")
+
+	e := Entry{}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Endpoint != "a/b/c" || e.ID != "abc" {
+		t.Errorf("decoded to %+v", e)
+	}
+}
+
+func TestLogSessionStart(t *testing.T) {
+	cases := []struct {
+		name string
+		lc   func() *Config
+		want string
+	}{
+		{"default", func() *Config { return &Config{} }, "INFO@ep:abc: logger_test.go:%d: \n"},
+		{"on", func() *Config { return (&Config{}).LogSessionStart(true) }, "INFO@ep:abc: logger_test.go:%d: \n"},
+		{"off", func() *Config { return (&Config{}).LogSessionStart(false) }, ""},
+	}
+
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		lc := c.lc().Writer(Info, buf).Flags(log.Lshortfile)
+
+		lc.NewSessionLoggerWithID("ep", "abc")
+		at := line() - 1
+		lc.NewMasterLogger()
+		lc.NewMasterLoggerWithID("abc")
+
+		want := c.want
+		if want != "" {
+			want = fmt.Sprintf(want, at)
+		}
+		if buf.String() != want {
+			t.Errorf("%s: output %q, want %q", c.name, buf.String(), want)
+		}
+	}
+}
+
+func TestWithWriter(t *testing.T) {
+	normal, special := &bytes.Buffer{}, &bytes.Buffer{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, normal)
+	}
+	parent := lc.NewSessionLoggerWithID("ep", "abc")
+	l := parent.WithFields(map[string]any{"k": 1}).WithWriter(Err, special)
+
+	l.Info("info")
+	l.Err("err")
+	parent.Err("parent err")
+
+	if want := "INFO@ep:abc: info k=1\n ERR@ep:abc: parent err\n"; normal.String() != want {
+		t.Errorf("normal writer got %q, want %q", normal.String(), want)
+	}
+	if want := " ERR@ep:abc: err k=1\n"; special.String() != want {
+		t.Errorf("override got %q, want %q", special.String(), want)
+	}
+	if l.ID != parent.ID {
+		t.Errorf("ID changed from %q to %q", parent.ID, l.ID)
+	}
+}
+
+func TestLoggerWriter(t *testing.T) {
+	info, warn := &bytes.Buffer{}, &bytes.Buffer{}
+	l := (&Config{}).Writer(Info, info).Writer(Warn, warn).Flags(NoFlags).LogSessionStart(false).
+		NewSessionLoggerWithID("ep", "abc").WithFields(map[string]any{"k": "v"})
+
+	w := l.Writer(Warn)
+	l.Warn("through the logger")
+	fmt.Fprintln(w, "raw line")
+	l.SetLevelEnabled(Warn, false)
+	fmt.Fprintln(w, "dropped")
+
+	if want := "WARN@ep:abc: through the logger k=v\nraw line\n"; warn.String() != want {
+		t.Errorf("warn writer got %q, want %q", warn.String(), want)
+	}
+	if info.Len() != 0 {
+		t.Errorf("info writer got %q", info.String())
+	}
+}
+
+func TestNopLogger(t *testing.T) {
+	stdout, stderr := swapStdStreams(t)
+
+	l := NewNopLogger()
+	l.Debug("d")
+	l.Infof("%d", 1)
+	l.WarnKV("w", "k", 1)
+	l.Err("e")
+	l.I.Print("direct")
+	l.Sub("child").WithFields(map[string]any{"k": 1}).Info("derived")
+
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("wrote %q and %q", stdout.String(), stderr.String())
+	}
+	if l.ID != "NOP" || l.InfoEnabled() {
+		t.Errorf("ID %q, InfoEnabled %v", l.ID, l.InfoEnabled())
+	}
+	if _, ok := LoggerByID("NOP"); ok {
+		t.Errorf("nop logger is registered")
+	}
+	if n := testing.AllocsPerRun(100, func() { l.Infof("x %d", 1) }); n != 0 {
+		t.Errorf("Infof on a nop logger allocates %v times", n)
+	}
+}
+
+func BenchmarkNopLogger(b *testing.B) {
+	l := NewNopLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("request handled")
+		l.Warnf("took %d ms", 12)
+	}
+}
+
+func TestFormattingMethods(t *testing.T) {
+	var bufs [4]bytes.Buffer
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for lvl := range bufs {
+		lc.Writer(logLevel(lvl), &bufs[lvl])
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	cases := []struct {
+		log   func(format string, v ...any)
+		level logLevel
+		want  string
+	}{
+		{l.Debugf, Debug, "DBUG@ep:abc: 1 + 1 = 2\n"},
+		{l.Infof, Info, "INFO@ep:abc: 1 + 1 = 2\n"},
+		{l.Warnf, Warn, "WARN@ep:abc: 1 + 1 = 2\n"},
+		{l.Errf, Err, " ERR@ep:abc: 1 + 1 = 2\n"},
+	}
+	for _, c := range cases {
+		for i := range bufs {
+			bufs[i].Reset()
+		}
+		c.log("%d + %v = %s", 1, 1, "2")
+
+		for lvl := range bufs {
+			want := ""
+			if logLevel(lvl) == c.level {
+				want = c.want
+			}
+			if got := bufs[lvl].String(); got != want {
+				t.Errorf("%v message: %v writer got %q, want %q", c.level, logLevel(lvl), got, want)
+			}
+		}
+	}
+}
+
+func TestNewMasterLoggerWithID(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Writer(Err, cw).Flags(NoFlags)
+
+	named := lc.NewMasterLoggerWithID("web-3")
+	plain := lc.NewMasterLogger()
+	named.Info("up")
+	named.Err("down")
+	plain.Info("anonymous")
+	named.Sub("db").Info("sub")
+	lc.PrefixFormat("[", "|", "]").NewMasterLoggerWithID("web-3").Info("custom")
+
+	if named.ID != "web-3" || !named.IsMaster() {
+		t.Errorf("named master has ID %q, IsMaster %v", named.ID, named.IsMaster())
+	}
+	if plain.ID != "MASTER" {
+		t.Errorf("plain master has ID %q", plain.ID)
+	}
+	want := []string{
+		"INFO web-3: up", " ERR web-3: down", "INFO: anonymous", "INFO@db:web-3: sub", "INFO web-3: custom",
+	}
+	if got := cw.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestLevelEnabled(t *testing.T) {
+	l := (&Config{}).Disable(Debug).Disable(Warn).LogSessionStart(false).NewSessionLogger("ep")
+
+	got := [4]bool{l.DebugEnabled(), l.InfoEnabled(), l.WarnEnabled(), l.ErrEnabled()}
+	if want := [4]bool{false, true, false, true}; got != want {
+		t.Errorf("enabled = %v, want %v", got, want)
+	}
+
+	if n := testing.AllocsPerRun(100, func() { l.Debugf("%s %d", "x", 1) }); n != 0 {
+		t.Errorf("Debugf on a disabled level allocates %v times", n)
+	}
+
+	l.SetLevelEnabled(Warn, true)
+	l.Mute()
+	if l.WarnEnabled() || l.ErrEnabled() {
+		t.Errorf("levels enabled while muted")
+	}
+	l.Unmute()
+	if !l.WarnEnabled() {
+		t.Errorf("Warn disabled after SetLevelEnabled and Unmute")
+	}
+}
+
+func BenchmarkDisabledInfof(b *testing.B) {
+	l := (&Config{}).Disable(Info).LogSessionStart(false).NewSessionLogger("bench")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infof("request %s took %d ms", "/api", 12)
+	}
+}
+
+func TestTee(t *testing.T) {
+	normal, extra := &CaptureWriter{}, &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, normal)
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	l.Info("before")
+	undo := l.Tee(extra)
+	l.Info("during")
+	l.Err("during err")
+	undo()
+	l.Info("after")
+
+	want := "INFO@ep:abc: before|INFO@ep:abc: during| ERR@ep:abc: during err|INFO@ep:abc: after"
+	if got := strings.Join(normal.Lines(), "|"); got != want {
+		t.Errorf("normal writer got %q", got)
+	}
+	if got := strings.Join(extra.Lines(), "|"); got != "INFO@ep:abc: during| ERR@ep:abc: during err" {
+		t.Errorf("tee got %q", got)
+	}
+}
+
+func TestTeeBrokenWriter(t *testing.T) {
+	normal := &CaptureWriter{}
+	l := (&Config{}).Writer(Info, normal).Flags(NoFlags).LogSessionStart(false).NewMasterLogger()
+
+	defer l.Tee(brokenWriter{err: io.ErrClosedPipe})()
+	l.Info("fine")
+	if normal.String() != "INFO: fine\n" {
+		t.Errorf("normal writer got %q", normal.String())
+	}
+}
+
+// Run with -race.
+func TestTeeConcurrent(t *testing.T) {
+	normal, extra := &CaptureWriter{}, &CaptureWriter{}
+	l := (&Config{}).Writer(Info, normal).Flags(NoFlags).LogSessionStart(false).NewMasterLogger()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info("x")
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		l.Tee(extra)()
+	}
+	wg.Wait()
+
+	if n := len(normal.Lines()); n != 400 {
+		t.Errorf("normal writer got %d lines, want 400", n)
+	}
+}
+
+func TestNewSplitFileConfig(t *testing.T) {
+	stdout, stderr := swapStdStreams(t)
+
+	dir := t.TempDir()
+	lc, closeAll, err := NewSplitFileConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc.Flags(NoFlags).LogSessionStart(false)
+
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+	l.Debug("d")
+	l.Info("i")
+	l.Warn("w")
+	l.Err("e")
+	if err := closeAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	for _, name := range logFiles(t, dir) {
+		b, _ := os.ReadFile(filepath.Join(dir, name))
+		part := strings.TrimSuffix(name[strings.LastIndex(name, "-")+1:], ".log")
+		files[part] = string(b)
+	}
+	want := map[string]string{
+		"info": "DBUG@ep:abc: d\nINFO@ep:abc: i\n",
+		"warn": "WARN@ep:abc: w\n",
+		"err":  " ERR@ep:abc: e\n",
+	}
+	if fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+	if stdout.String() != want["info"]+want["warn"] || stderr.String() != want["err"] {
+		t.Errorf("streams got %q and %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestNewSplitFileConfigFails(t *testing.T) {
+	dir := t.TempDir()
+
+	// Directories in the way of the warn file make creating it fail, after the info file was made.
+	now := time.Now().UTC()
+	for _, at := range []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second)} {
+		os.Mkdir(filepath.Join(dir, at.Format(logFileLayout+"-warn.log")), 0775)
+	}
+
+	lc, closeAll, err := NewSplitFileConfig(dir)
+	if err == nil {
+		closeAll()
+		t.Fatalf("NewSplitFileConfig worked with the warn file blocked")
+	}
+	if lc != nil || closeAll != nil {
+		t.Errorf("got a config or close function along with the error")
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, cw)
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	eu := l.WithPrefix("eu-west")
+	eu.Debug("d")
+	eu.Info("i")
+	eu.Warn("w")
+	eu.Err("e")
+	eu.WithPrefix("tenant=7").Sub("child").Info("stacked")
+	lc.NewMasterLogger().WithPrefix("boot").Info("master")
+	l.Info("original")
+
+	want := []string{
+		"DBUG eu-west@ep:abc: d",
+		"INFO eu-west@ep:abc: i",
+		"WARN eu-west@ep:abc: w",
+		" ERR eu-west@ep:abc: e",
+		"INFO eu-west tenant=7@ep/child:abc: stacked",
+		"INFO boot: master",
+		"INFO@ep:abc: original",
+	}
+	if got := cw.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSetDefaultConfig(t *testing.T) {
+	old := DefaultConfigSnapshot()
+	defer SetDefaultConfig(old)
+
+	first, second := &CaptureWriter{}, &CaptureWriter{}
+	SetDefaultConfig((&Config{}).Writer(Warn, first).Flags(NoFlags).LogSessionStart(false))
+	before := NewMasterLogger()
+
+	lc := (&Config{}).Writer(Warn, second).Flags(NoFlags).LogSessionStart(false)
+	SetDefaultConfig(lc)
+	if DefaultConfigSnapshot() != lc {
+		t.Fatalf("DefaultConfigSnapshot did not return the new config")
+	}
+
+	NewMasterLogger().Warn("new default")
+	NewSessionLoggerWithID("ep", "abc").Warn("session")
+	before.Warn("old default") // Loggers made before the swap keep the old config.
+
+	if want := "WARN: new default\nWARN@ep:abc: session\n"; second.String() != want {
+		t.Errorf("new config got %q, want %q", second.String(), want)
+	}
+	if want := "WARN: old default\n"; first.String() != want {
+		t.Errorf("old config got %q, want %q", first.String(), want)
+	}
+
+	SetDefaultConfig(nil)
+	if DefaultConfigSnapshot() == nil || DefaultConfigSnapshot() == lc {
+		t.Errorf("SetDefaultConfig(nil) did not install a new zero config")
+	}
+}
+
+func TestClone(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, cw).Flags(NoFlags).LogSessionStart(false)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	ids := map[string]bool{}
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := l.Clone()
+			lock.Lock()
+			ids[c.ID] = true
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	for i := 1; i <= 20; i++ {
+		if !ids[fmt.Sprintf("abc.%d", i)] {
+			t.Errorf("missing clone ID abc.%d in %v", i, ids)
+		}
+	}
+
+	c := l.Clone().Clone()
+	c.Info("grandchild")
+	lc.NewMasterLogger().Clone().Info("master clone")
+	if want := "INFO@ep:abc.21.1: grandchild\nINFO MASTER.1: master clone\n"; cw.String() != want {
+		t.Errorf("output %q, want %q", cw.String(), want)
+	}
+	if l.ID != "abc" || c.SameSession(l) {
+		t.Errorf("clone shares the session of its parent")
+	}
+}
+
+func TestTagged(t *testing.T) {
+	normal, audit, billing := &CaptureWriter{}, &CaptureWriter{}, &CaptureWriter{}
+	lc := (&Config{}).Writer(Info, normal).Writer(Err, normal).Flags(NoFlags).LogSessionStart(false).
+		TagWriter("audit", audit).TagWriter("billing", billing)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	l.Tagged("audit", "billing", "unknown").Info("charged card")
+	l.Tagged("audit").Err("refused")
+	l.Info("untagged")
+
+	if want := "INFO@ep:abc: charged card\n ERR@ep:abc: refused\nINFO@ep:abc: untagged\n"; normal.String() != want {
+		t.Errorf("normal writer got %q, want %q", normal.String(), want)
+	}
+	if want := "INFO@ep:abc: charged card\n ERR@ep:abc: refused\n"; audit.String() != want {
+		t.Errorf("audit writer got %q, want %q", audit.String(), want)
+	}
+	if want := "INFO@ep:abc: charged card\n"; billing.String() != want {
+		t.Errorf("billing writer got %q, want %q", billing.String(), want)
+	}
+
+	// Removing a tag from the config only affects loggers created afterwards.
+	lc.TagWriter("billing")
+	lc.NewMasterLogger().Tagged("billing").Info("gone")
+	if billing.Contains("gone") {
+		t.Errorf("removed tag still written to")
+	}
+}
+
+func TestCreateLogFileExclusive(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sub")
+
+	f, err := CreateLogFileExclusive(dir, "run.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("keep me\n")
+	f.Close()
+
+	f, err = CreateLogFileExclusive(dir, "run.log")
+	if err == nil {
+		f.Close()
+		t.Fatal("second create worked")
+	}
+	if !errors.Is(err, os.ErrExist) || !strings.Contains(err.Error(), `"run.log" already exists`) {
+		t.Errorf("error = %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "run.log")); string(b) != "keep me\n" {
+		t.Errorf("existing file changed to %q", b)
+	}
+}
+
+func TestCreateLogFileLocal(t *testing.T) {
+	// time.Local is not changed for the test, since other goroutines (such as the one making IDs) read it.
+	if _, offset := time.Now().Zone(); offset == 0 {
+		t.Skip("the local time zone is UTC, so the names would be the same")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		create func(string) (*os.File, error)
+		zone   *time.Location
+	}{
+		{"CreateLogFile", CreateLogFile, time.UTC},
+		{"CreateLogFileLocal", CreateLogFileLocal, time.Local},
+	} {
+		before := time.Now().In(tc.zone).Format(logFileLayout + ".log")
+		f, err := tc.create(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		after := time.Now().In(tc.zone).Format(logFileLayout + ".log")
+
+		if name := filepath.Base(f.Name()); name != before && name != after {
+			t.Errorf("%v made %q, want %q", tc.name, name, after)
+		}
+	}
+}
+
+func TestConfigUTC(t *testing.T) {
+	zone := time.FixedZone("test", -3*60*60)
+	clock := func() time.Time { return time.Date(2022, 3, 4, 23, 30, 0, 0, zone) }
+
+	buf := &bytes.Buffer{}
+	lc := (&Config{Clock: clock}).Flags(log.Ldate|log.Ltime).Writer(Info, buf)
+	lc.UTC(true).NewMasterLogger().Info("utc")
+	lc.UTC(false).NewMasterLogger().Info("local")
+
+	if lc.flags() != log.Ldate|log.Ltime {
+		t.Errorf("UTC(false) left flags %b", lc.flags())
+	}
+	want := "INFO: 2022/03/05 02:30:00 utc\nINFO: 2022/03/04 23:30:00 local\n"
+	if buf.String() != want {
+		t.Errorf("output %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLogError(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, cw)
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	l.LogError("nothing happened", nil)
+	if cw.String() != "" {
+		t.Errorf("nil error logged %q", cw.String())
+	}
+
+	l.LogError("reading the config failed", fmt.Errorf("open %v: %w", "app.conf", os.ErrNotExist))
+	want := " ERR@ep:abc: reading the config failed: open app.conf: file does not exist\n"
+	if cw.String() != want {
+		t.Errorf("output %q, want %q", cw.String(), want)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	fc := &fakeClock{t: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cw := &CaptureWriter{}
+	lc := (&Config{Clock: fc.now}).Flags(NoFlags).LogSessionStart(false).Writer(Info, cw).Writer(Warn, cw)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	done := l.Timer("loading")
+	fc.t = fc.t.Add(1500 * time.Millisecond)
+	done()
+
+	quick := l.Timer("saving", time.Second)
+	fc.t = fc.t.Add(250 * time.Millisecond)
+	quick()
+
+	slow := l.Timer("saving", time.Second)
+	fc.t = fc.t.Add(2 * time.Second)
+	slow()
+
+	want := []string{
+		"INFO@ep:abc: loading took 1.5s",
+		"INFO@ep:abc: saving took 250ms",
+		"WARN@ep:abc: saving took 2s (more than 1s)",
+	}
+	if got := cw.Lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestPrefixEachLine(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Err, buf).PrefixEachLine(true)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	l.Err("panic: oops\ngoroutine 1 [running]:\n")
+	l.Errf("one line\n")
+
+	want := " ERR@ep:abc: panic: oops\n ERR@ep:abc: goroutine 1 [running]:\n ERR@ep:abc: one line\n"
+	if buf.String() != want {
+		t.Errorf("output %q, want %q", buf.String(), want)
+	}
+
+	// Off by default.
+	buf.Reset()
+	lc.PrefixEachLine(false).NewSessionLoggerWithID("ep", "abc").Err("two\nlines")
+	if want := " ERR@ep:abc: two\nlines\n"; buf.String() != want {
+		t.Errorf("output %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLog(t *testing.T) {
+	var bufs [4]bytes.Buffer
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Disable(Debug)
+	for lvl := range bufs {
+		lc.Writer(logLevel(lvl), &bufs[lvl])
+	}
+	l := lc.NewMasterLogger()
+
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err, -1, 4} {
+		l.Log(lvl, "%v", int(lvl))
+		l.Logln(lvl, "ln", int(lvl))
+	}
+
+	want := [4]string{
+		"",
+		"INFO: 1\nINFO: ln 1\nINFO: -1\nINFO: ln -1\nINFO: 4\nINFO: ln 4\n",
+		"WARN: 2\nWARN: ln 2\n",
+		" ERR: 3\n ERR: ln 3\n",
+	}
+	for lvl := range bufs {
+		if got := bufs[lvl].String(); got != want[lvl] {
+			t.Errorf("%v writer got %q, want %q", logLevel(lvl), got, want[lvl])
+		}
+	}
+}
+
+func TestErrWithStacks(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{StackDumps: true}).Flags(NoFlags).LogSessionStart(false).Writer(Err, cw).PrefixEachLine(true)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	l.ErrWithStacks("everything is on fire")
+	got := cw.Lines()
+	if len(got) < 3 || got[0] != " ERR@ep:abc: everything is on fire" || !strings.HasPrefix(got[1], " ERR@ep:abc: goroutine ") {
+		t.Fatalf("output starts %q", got[:min(len(got), 3)])
+	}
+	for _, line := range got {
+		if !strings.HasPrefix(line, " ERR@ep:abc: ") {
+			t.Errorf("line without the prefix: %q", line)
+		}
+	}
+	if !cw.Contains("sessionlogger.TestErrWithStacks(") {
+		t.Errorf("dump does not include this goroutine:\n%v", cw.String())
+	}
+
+	// Without StackDumps it is just Err.
+	cw.Reset()
+	(&Config{}).Flags(NoFlags).Writer(Err, cw).NewMasterLogger().ErrWithStacks("small fire")
+	if cw.String() != " ERR: small fire\n" {
+		t.Errorf("output %q", cw.String())
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	cw := &CaptureWriter{}
+	l := (&Config{}).Flags(NoFlags).Writer(Info, cw).NewMasterLoggerWithID("host")
+
+	before := runtime.NumGoroutine()
+	stop := l.Heartbeat(time.Millisecond)
+	for deadline := time.Now().Add(5 * time.Second); len(cw.Lines()) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("no heartbeats after 5s: %q", cw.Lines())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	stop()
+
+	got := cw.Lines()
+	if got[0] != "INFO host: still alive (host, heartbeat 1)" || got[1] != "INFO host: still alive (host, heartbeat 2)" {
+		t.Errorf("heartbeats %q", got)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines after stop, %d before", after, before)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := len(cw.Lines()); n != len(got) {
+		t.Errorf("%d heartbeats after stop", n-len(got))
+	}
+}
+
+func TestIsMaster(t *testing.T) {
+	lc := (&Config{}).LogSessionStart(false)
+	master := lc.NewMasterLogger()
+	session := lc.NewSessionLogger("ep")
+
+	cases := map[string]struct {
+		l    *Logger
+		want bool
+	}{
+		"master":            {master, true},
+		"master with ID":    {lc.NewMasterLoggerWithID("host"), true},
+		"nop":               {NewNopLogger(), true},
+		"master clone":      {master.Clone(), true},
+		"session":           {session, false},
+		"session named so":  {lc.NewSessionLoggerWithID("ep", "MASTER"), false},
+		"session sub":       {session.Sub("child"), false},
+		"session with tags": {session.Tagged("audit").WithPrefix("x"), false},
+	}
+	for name, c := range cases {
+		if got := c.l.IsMaster(); got != c.want {
+			t.Errorf("%v: IsMaster() = %v, want %v", name, got, c.want)
+		}
+	}
+	if master.ID != "MASTER" {
+		t.Errorf("master logger has the ID %q", master.ID)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	old, other, cur := &CaptureWriter{}, &CaptureWriter{}, &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Info, old).Writer(Warn, other).Disable(Debug)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+	derived := l.WithPrefix("x")
+
+	l.Info("before")
+	l.SetOutput(Info, cur)
+	l.SetOutput(Debug, cur)
+	l.Info("after")
+	l.Warn("warn")
+	derived.Info("derived")
+	l.Debug("still disabled")
+	l.SetLevelEnabled(Debug, true)
+	l.Debug("enabled")
+
+	if got := old.String(); got != "INFO@ep:abc: before\nINFO x@ep:abc: derived\n" {
+		t.Errorf("old writer got %q", got)
+	}
+	if got := cur.String(); got != "INFO@ep:abc: after\nDBUG@ep:abc: enabled\n" {
+		t.Errorf("new writer got %q", got)
+	}
+	if got := other.String(); got != "WARN@ep:abc: warn\n" {
+		t.Errorf("warn writer got %q", got)
+	}
+}
+
+func TestSetOutputJSON(t *testing.T) {
+	cw := &CaptureWriter{}
+	l := (&Config{}).JSON(true).Flags(NoFlags).LogSessionStart(false).Writer(Info, io.Discard).
+		NewSessionLoggerWithID("ep", "abc").WithFields(map[string]any{"k": "v"})
+
+	l.SetOutput(Info, cw)
+	l.Info("moved")
+	entries, err := ParseEntries(strings.NewReader(cw.String()))
+	if err != nil || len(entries) != 1 || entries[0].Msg != "moved" || entries[0].Fields["k"] != "v" {
+		t.Errorf("output %q", cw.String())
+	}
+}
+
+// Run with -race.
+func TestSetOutputConcurrent(t *testing.T) {
+	l := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Info, io.Discard).NewMasterLogger()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.Info("busy")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.SetOutput(Info, &CaptureWriter{})
+		}
+	}()
+	wg.Wait()
+}
+
+func TestLogFilePaths(t *testing.T) {
+	dir := t.TempDir()
+	sep := string(filepath.Separator)
+
+	f, err := OpenLogFile(dir+sep+"logs"+sep, "app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if want := filepath.Join(dir, "logs", "app.log"); f.Name() != want {
+		t.Errorf("trailing separator gave %q, want %q", f.Name(), want)
+	}
+
+	f, err = CreateLogFile(dir + sep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if strings.Contains(f.Name(), sep+sep) || filepath.Dir(f.Name()) != filepath.Clean(dir) {
+		t.Errorf("CreateLogFile made %q", f.Name())
+	}
+
+	// An empty directory is the current one.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	f, err = OpenLogFile("", "here.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if f.Name() != "here.log" {
+		t.Errorf("empty directory gave %q", f.Name())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "here.log")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLogFilePathsWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Windows paths are only handled on Windows")
+	}
+
+	dir := t.TempDir()
+	f, err := OpenLogFile(dir+`/logs/`, "app.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if want := dir + `\logs\app.log`; f.Name() != want {
+		t.Errorf("got %q, want %q", f.Name(), want)
+	}
+}
+
+func TestMute(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Disable(Debug)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, cw)
+	}
+	l := lc.NewMasterLogger()
+
+	l.Mute()
+	l.Mute()
+	l.Info("i")
+	l.W.Print("w")
+	l.Err("e")
+	l.Writer(Info).Write([]byte("raw\n"))
+	if cw.String() != "" {
+		t.Errorf("muted logger wrote %q", cw.String())
+	}
+
+	l.Unmute()
+	l.Unmute()
+	l.Debug("still disabled")
+	l.Info("i")
+	l.W.Print("w")
+	l.Err("e")
+	if want := "INFO: i\nWARN: w\n ERR: e\n"; cw.String() != want {
+		t.Errorf("after Unmute got %q, want %q", cw.String(), want)
+	}
+}
+
+// Run with -race.
+func TestMuteConcurrent(t *testing.T) {
+	l := (&Config{}).LogSessionStart(false).Writer(Info, io.Discard).NewMasterLogger()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.Info("busy")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.Mute()
+			l.Unmute()
+		}
+	}()
+	wg.Wait()
+}
+
+func TestWithTemporaryLevel(t *testing.T) {
+	l := (&Config{}).Disable(Debug).LogSessionStart(false).NewMasterLogger()
+
+	outer := l.WithTemporaryLevel(Debug, true)
+	if !l.DebugEnabled() {
+		t.Fatal("debug not enabled")
+	}
+	inner := l.WithTemporaryLevel(Debug, false)
+	innermost := l.WithTemporaryLevel(Debug, true)
+	innermost()
+	if l.DebugEnabled() {
+		t.Error("debug enabled after restoring the innermost change")
+	}
+	inner()
+	inner()
+	if !l.DebugEnabled() {
+		t.Error("debug disabled after restoring the inner change")
+	}
+	outer()
+	if l.DebugEnabled() {
+		t.Error("debug enabled after restoring everything")
+	}
+
+	// Mute wins while it is in place, and the change survives it.
+	l.Mute()
+	restore := l.WithTemporaryLevel(Info, false)
+	l.Unmute()
+	if l.InfoEnabled() {
+		t.Error("info enabled during the temporary change")
+	}
+	restore()
+	if !l.InfoEnabled() {
+		t.Error("info disabled after restoring")
+	}
+}
+
+func TestSameSession(t *testing.T) {
+	lc := (&Config{}).LogSessionStart(false)
+	l := lc.NewSessionLoggerWithID("/api", "abc")
+	var none *Logger
+
+	cases := []struct {
+		name  string
+		other *Logger
+		want  bool
+	}{
+		{"itself", l, true},
+		{"with fields", l.WithFields(map[string]any{"k": 1}), true},
+		{"with prefix", l.WithPrefix("tenant"), true},
+		{"same ID and endpoint", lc.NewSessionLoggerWithID("/api", "abc"), true},
+		{"other endpoint", lc.NewSessionLoggerWithID("/other", "abc"), false},
+		{"other ID", lc.NewSessionLoggerWithID("/api", "xyz"), false},
+		{"sub", l.Sub("child"), false},
+		{"clone", l.Clone(), false},
+		{"master", lc.NewMasterLoggerWithID("abc"), false},
+		{"nil", none, false},
+	}
+	for _, c := range cases {
+		if got := l.SameSession(c.other); got != c.want {
+			t.Errorf("%v: SameSession = %v, want %v", c.name, got, c.want)
+		}
+		if c.other != nil && c.other.SameSession(l) != c.want {
+			t.Errorf("%v: SameSession is not symmetric", c.name)
+		}
+	}
+	if !none.SameSession(nil) {
+		t.Errorf("nil is not the same session as nil")
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	lc := (&Config{}).LogSessionStart(false).PrefixFormat("[", "|", "]")
+
+	cases := map[string]struct {
+		l    *Logger
+		want string
+	}{
+		"session":     {lc.NewSessionLogger("/api"), "/api"},
+		"sub":         {lc.NewSessionLogger("/api").Sub("auth"), "/api/auth"},
+		"master":      {lc.NewMasterLogger(), ""},
+		"master sub":  {lc.NewMasterLogger().Sub("stdlog"), "stdlog"},
+		"nop":         {NewNopLogger(), ""},
+		"with writer": {lc.NewSessionLogger("/x").WithWriter(Info, io.Discard), "/x"},
+	}
+	for name, c := range cases {
+		if got := c.l.Endpoint(); got != c.want {
+			t.Errorf("%v: Endpoint() = %q, want %q", name, got, c.want)
+		}
+	}
+}
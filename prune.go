@@ -0,0 +1,171 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "sort"
+import "time"
+import "strings"
+import "path/filepath"
+
+// logFile is a log file found by listLogs.
+type logFile struct {
+	path string
+	mod  time.Time
+}
+
+// listLogs lists the log files (names ending in .log or .log.gz) in logdir, oldest first by modification time.
+// Files that are the same as one of the open files (as decided by os.SameFile) are left out.
+func listLogs(logdir string, open []string) ([]logFile, error) {
+	if logdir == "" {
+		logdir = "."
+	}
+	entries, err := os.ReadDir(logdir)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := []os.FileInfo{}
+	for _, name := range open {
+		info, err := os.Stat(name)
+		if err == nil {
+			keep = append(keep, info)
+		}
+	}
+
+	files := []logFile{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log.gz")) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			// Probably deleted since the directory was read.
+			continue
+		}
+		if sameAsAny(info, keep) {
+			continue
+		}
+		files = append(files, logFile{path: filepath.Join(logdir, name), mod: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].mod.Equal(files[j].mod) {
+			return files[i].path < files[j].path
+		}
+		return files[i].mod.Before(files[j].mod)
+	})
+	return files, nil
+}
+
+// sameAsAny reports if info is the same file as any of the others.
+func sameAsAny(info os.FileInfo, others []os.FileInfo) bool {
+	for _, o := range others {
+		if os.SameFile(info, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeLogs removes the given files, ignoring ones that are already gone. The first error is returned, but
+// removal continues past it.
+func removeLogs(files []logFile) error {
+	var first error
+	for _, f := range files {
+		err := os.Remove(f.path)
+		if err != nil && !os.IsNotExist(err) && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// PruneLogs deletes all but the newest keep log files (files ending in .log or .log.gz) in logdir, going by
+// modification time. The files named in open are never deleted, and do not count towards keep. Pass the files
+// that are in use, which Config.LogFiles will find for you:
+//
+//	err := sessionlogger.PruneLogs("logs", 10, lc.LogFiles()...)
+//
+// If open is empty the newest file is always kept, even if keep is 0, since it is most likely the one in use.
+// It is safe to call periodically, for example from a time.Ticker loop.
+func PruneLogs(logdir string, keep int, open ...string) error {
+	if keep < 0 {
+		keep = 0
+	}
+	if keep < 1 && len(open) == 0 {
+		keep = 1
+	}
+
+	files, err := listLogs(logdir, open)
+	if err != nil {
+		return err
+	}
+	if len(files) <= keep {
+		return nil
+	}
+	return removeLogs(files[:len(files)-keep])
+}
+
+// PruneLogsOlderThan deletes log files (files ending in .log or .log.gz) in logdir that were last modified more
+// than age ago. Like PruneLogs, the files named in open are never deleted, and if open is empty the newest file
+// is always kept.
+func PruneLogsOlderThan(logdir string, age time.Duration, open ...string) error {
+	files, err := listLogs(logdir, open)
+	if err != nil {
+		return err
+	}
+	if len(open) == 0 && len(files) > 0 {
+		files = files[:len(files)-1]
+	}
+
+	cutoff := time.Now().Add(-age)
+	old := []logFile{}
+	for _, f := range files {
+		if f.mod.Before(cutoff) {
+			old = append(old, f)
+		}
+	}
+	return removeLogs(old)
+}
+
+// LogFiles returns the names of the files this config currently writes to, including the current file of any
+// RotatingWriter, for passing to PruneLogs and PruneLogsOlderThan. Files are found the same way as for Close,
+// so a file hidden inside a writer from outside this package is missed.
+func (lc *Config) LogFiles() []string {
+	lc.lock.RLock()
+	all := flatWriters(lc.allWriters()...)
+	lc.lock.RUnlock()
+
+	names := []string{}
+	for _, w := range all {
+		if w == os.Stdout || w == os.Stderr {
+			continue
+		}
+		if nw, ok := w.(interface{ Name() string }); ok && nw.Name() != "" {
+			names = append(names, nw.Name())
+		}
+	}
+	return names
+}
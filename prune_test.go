@@ -0,0 +1,170 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "time"
+import "sort"
+import "strings"
+import "testing"
+import "path/filepath"
+
+// fakeLogs creates the named files in dir, each an hour older than the one after it (so the last is the newest).
+func fakeLogs(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	start := time.Now().Add(-time.Duration(len(names)) * time.Hour)
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+		mod := start.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func remaining(t *testing.T, dir string) string {
+	t.Helper()
+
+	names := logFiles(t, dir)
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func TestPruneLogs(t *testing.T) {
+	cases := []struct {
+		keep int
+		open []string
+		want string
+	}{
+		{10, nil, "a.log b.log.gz c.log d.log e.log notes.txt"},
+		{2, nil, "d.log e.log notes.txt"},
+		{0, nil, "e.log notes.txt"}, // With no open files the newest is kept.
+		{-1, nil, "e.log notes.txt"},
+		{1, []string{"a.log"}, "a.log e.log notes.txt"},
+		{2, []string{"d.log", "e.log"}, "b.log.gz c.log d.log e.log notes.txt"},
+		{0, []string{"b.log.gz", "gone.log"}, "b.log.gz notes.txt"},
+	}
+
+	for i, c := range cases {
+		dir := t.TempDir()
+		fakeLogs(t, dir, "a.log", "notes.txt", "b.log.gz", "c.log", "d.log", "e.log")
+		open := []string{}
+		for _, name := range c.open {
+			open = append(open, filepath.Join(dir, name))
+		}
+
+		if err := PruneLogs(dir, c.keep, open...); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if got := remaining(t, dir); got != c.want {
+			t.Errorf("case %d: left %q, want %q", i, got, c.want)
+		}
+	}
+}
+
+func TestPruneLogsOlderThan(t *testing.T) {
+	dir := t.TempDir()
+	fakeLogs(t, dir, "a.log", "b.log", "c.log", "d.log")
+
+	// a is 4 hours old, b 3, c 2, and d 1.
+	if err := PruneLogsOlderThan(dir, 150*time.Minute, filepath.Join(dir, "a.log")); err != nil {
+		t.Fatal(err)
+	}
+	if got := remaining(t, dir); got != "a.log c.log d.log" {
+		t.Errorf("left %q", got)
+	}
+
+	// With no open files the newest is kept.
+	if err := PruneLogsOlderThan(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := remaining(t, dir); got != "d.log" {
+		t.Errorf("left %q", got)
+	}
+
+	// Once the open files are given, nothing is special about the newest file.
+	if err := PruneLogsOlderThan(dir, 0, filepath.Join(dir, "gone.log")); err != nil {
+		t.Fatal(err)
+	}
+	if got := remaining(t, dir); got != "" {
+		t.Errorf("left %q", got)
+	}
+}
+
+func TestPruneLogsKeepsSplitFiles(t *testing.T) {
+	dir := t.TempDir()
+	fakeLogs(t, dir, "old1.log", "old2.log")
+
+	lc, closeAll, err := NewSplitFileConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAll()
+
+	// The old files are the newest by modification time, open files must be kept anyway.
+	future := time.Now().Add(time.Hour)
+	for _, name := range []string{"old1.log", "old2.log"} {
+		os.Chtimes(filepath.Join(dir, name), future, future)
+	}
+
+	open := lc.LogFiles()
+	if len(open) != 3 {
+		t.Fatalf("LogFiles() = %q, want the three split files", open)
+	}
+	if err := PruneLogs(dir, 0, open...); err != nil {
+		t.Fatal(err)
+	}
+	if left := logFiles(t, dir); len(left) != 3 {
+		t.Errorf("left %q, want only the open files", left)
+	}
+	for _, name := range open {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("open file removed: %v", err)
+		}
+	}
+}
+
+func TestLogFilesRotatingWriter(t *testing.T) {
+	dir := t.TempDir()
+	rw, err := NewRotatingWriter(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+	lc := (&Config{}).Writer(Info, rw, os.Stdout)
+
+	rw.Rotate()
+	if got := lc.LogFiles(); len(got) != 1 || got[0] != rw.Name() {
+		t.Fatalf("LogFiles() = %q, want [%q]", got, rw.Name())
+	}
+	if err := PruneLogs(dir, 0, lc.LogFiles()...); err != nil {
+		t.Fatal(err)
+	}
+	if left := logFiles(t, dir); len(left) != 1 || filepath.Join(dir, left[0]) != rw.Name() {
+		t.Errorf("left %q, want only %q", left, rw.Name())
+	}
+}
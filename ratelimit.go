@@ -0,0 +1,155 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "fmt"
+import "sync"
+import "time"
+import "sync/atomic"
+
+// rateLimit tracks how many messages have been written in the current one second window. It is shared by all
+// the writers that should be limited together.
+type rateLimit struct {
+	perSecond int
+	now       func() time.Time
+
+	lock       sync.Mutex
+	window     time.Time
+	count      int
+	suppressed int
+	w          io.Writer               // Where the last dropped message would have gone, the summary goes there.
+	sum        func(msg string) []byte // Lays out the summary for w, nil for a plain line.
+	timer      *time.Timer             // Writes the summary when the window is over, if nothing else does first.
+}
+
+func newRateLimit(perSecond int) *rateLimit {
+	return &rateLimit{perSecond: perSecond, now: time.Now}
+}
+
+// allow reports if a message written by rw may be written. If a new window was started, the number of messages
+// suppressed in the previous window is also returned.
+func (rl *rateLimit) allow(rw *rateLimitWriter) (ok bool, suppressed int) {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	t := rl.now()
+	if t.Sub(rl.window) >= time.Second {
+		suppressed = rl.take()
+		rl.window = t
+		rl.count = 0
+	}
+
+	if rl.count < rl.perSecond {
+		rl.count++
+		return true, suppressed
+	}
+	rl.suppressed++
+	rl.w, rl.sum = rw.w, rw.summary
+	if rl.timer == nil {
+		rl.timer = time.AfterFunc(rl.window.Add(time.Second).Sub(t), rl.expire)
+	}
+	return false, suppressed
+}
+
+// take returns the number of messages suppressed since the last summary, and resets it. The lock must be held.
+func (rl *rateLimit) take() int {
+	if rl.timer != nil {
+		rl.timer.Stop()
+		rl.timer = nil
+	}
+	n := rl.suppressed
+	rl.suppressed = 0
+	return n
+}
+
+// expire is called when the window with suppressed messages is over, so the summary is written even if no other
+// message comes along.
+func (rl *rateLimit) expire() {
+	rl.lock.Lock()
+	if rl.now().Sub(rl.window) < time.Second {
+		// The clock does not agree (it may be a fake one), leave the summary for the next write.
+		rl.timer = nil
+		rl.lock.Unlock()
+		return
+	}
+	n, w, sum := rl.take(), rl.w, rl.sum
+	rl.lock.Unlock()
+
+	writeRateSummary(w, sum, n)
+}
+
+// flush writes the summary for any messages suppressed so far, without waiting for the window to end.
+func (rl *rateLimit) flush() {
+	rl.lock.Lock()
+	n, w, sum := rl.take(), rl.w, rl.sum
+	rl.lock.Unlock()
+
+	writeRateSummary(w, sum, n)
+}
+
+// writeRateSummary writes the summary line for n suppressed messages to w, laid out with sum if it is not nil.
+// Nothing is written if n is 0.
+func writeRateSummary(w io.Writer, sum func(msg string) []byte, n int) {
+	if n == 0 {
+		return
+	}
+	msg := fmt.Sprintf("%d messages suppressed by rate limit", n)
+	if sum != nil {
+		w.Write(sum(msg))
+	} else {
+		io.WriteString(w, msg+"\n")
+	}
+}
+
+// rateLimitWriter drops writes that go over the rate limit. When the window is over a single line with the
+// number of dropped messages is written, before the next message if there is one.
+type rateLimitWriter struct {
+	w       io.Writer
+	rl      *rateLimit
+	dropped *atomic.Uint64          // Counts dropped writes, may be nil.
+	summary func(msg string) []byte // Lays out the summary line, see Config.summary. May be nil.
+}
+
+// RateLimitWriter wraps w so that at most perSecond writes (log messages) are passed through in any one second
+// window. Writes over the limit are dropped (but reported as successful), and the number dropped is reported
+// with a single summary line once the window is over.
+func RateLimitWriter(w io.Writer, perSecond int) io.Writer {
+	return &rateLimitWriter{w: w, rl: newRateLimit(perSecond)}
+}
+
+func (rw *rateLimitWriter) Write(p []byte) (int, error) {
+	ok, suppressed := rw.rl.allow(rw)
+	writeRateSummary(rw.w, rw.summary, suppressed)
+	if !ok {
+		if rw.dropped != nil {
+			rw.dropped.Add(1)
+		}
+		return len(p), nil
+	}
+	return rw.w.Write(p)
+}
+
+func (rw *rateLimitWriter) unwrap() []io.Writer {
+	return []io.Writer{rw.w}
+}
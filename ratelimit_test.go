@@ -0,0 +1,148 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "bytes"
+import "time"
+import "testing"
+
+func TestRateLimitWriter(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	buf := &bytes.Buffer{}
+	w := RateLimitWriter(buf, 2)
+	w.(*rateLimitWriter).rl.now = clock.now
+
+	steps := []struct {
+		advance time.Duration
+		msg     string
+		want    string
+	}{
+		{0, "a\n", "a\n"},
+		{100 * time.Millisecond, "b\n", "b\n"},
+		{100 * time.Millisecond, "c\n", ""},
+		{100 * time.Millisecond, "d\n", ""},
+		{699 * time.Millisecond, "e\n", ""}, // Still just inside the first window.
+		{time.Millisecond, "f\n", "3 messages suppressed by rate limit\nf\n"},
+		{0, "g\n", "g\n"},
+		{time.Second, "h\n", "h\n"}, // Nothing was dropped in the second window, so no summary.
+	}
+
+	for i, s := range steps {
+		clock.t = clock.t.Add(s.advance)
+		buf.Reset()
+
+		n, err := w.Write([]byte(s.msg))
+		if n != len(s.msg) || err != nil {
+			t.Errorf("step %d: Write returned %v, %v", i, n, err)
+		}
+		if buf.String() != s.want {
+			t.Errorf("step %d: wrote %q, want %q", i, buf.String(), s.want)
+		}
+	}
+}
+
+func TestRateLimitCountsDropped(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Warn, buf).Flags(NoFlags).LogSessionStart(false).RateLimit(Warn, 1)
+	lc.limits[Warn].now = (&fakeClock{t: time.Now()}).now
+
+	l := lc.NewMasterLogger()
+	for i := 0; i < 5; i++ {
+		l.Warn("flood")
+	}
+
+	if buf.String() != "WARN: flood\n" {
+		t.Errorf("output = %q", buf.String())
+	}
+	if st := lc.Stats(); st.Dropped != 4 || st.Messages[Warn] != 1 {
+		t.Errorf("Stats() = %+v", st)
+	}
+}
+
+func TestRateLimitSummaryFormat(t *testing.T) {
+	// In text mode the summary has the level token, so MinLevelWriter keeps it along with the messages.
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Warn, MinLevelWriter(Warn, buf)).Flags(NoFlags).LogSessionStart(false).RateLimit(Warn, 1)
+	clock := &fakeClock{t: time.Now()}
+	lc.limits[Warn].now = clock.now
+
+	l := lc.NewMasterLogger()
+	l.Warn("flood")
+	l.Warn("flood")
+	clock.t = clock.t.Add(time.Second)
+	l.Warn("flood")
+
+	want := "WARN: flood\nWARN: 1 messages suppressed by rate limit\nWARN: flood\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+
+	// In JSON mode it is an entry like any other.
+	buf.Reset()
+	lc = (&Config{}).Writer(Warn, buf).JSON(true).LogSessionStart(false).RateLimit(Warn, 1)
+	lc.limits[Warn].now = clock.now
+
+	l = lc.NewMasterLogger()
+	l.Warn("flood")
+	l.Warn("flood")
+	clock.t = clock.t.Add(time.Second)
+	l.Warn("flood")
+
+	entries, err := ParseEntries(buf)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("ParseEntries = %v entries, %v", len(entries), err)
+	}
+	if e := entries[1]; e.Level != "warn" || e.Msg != "1 messages suppressed by rate limit" {
+		t.Errorf("summary entry = %+v", e)
+	}
+}
+
+func TestRateLimitSummaryWithoutMoreMessages(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Writer(Warn, cw).Flags(NoFlags).LogSessionStart(false).RateLimit(Warn, 1)
+	l := lc.NewMasterLogger()
+	for i := 0; i < 3; i++ {
+		l.Warn("flood")
+	}
+
+	// The flood stops, the summary is written when the window is over anyway.
+	deadline := time.Now().Add(5 * time.Second)
+	for !cw.Contains("suppressed") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if want := "WARN: flood\nWARN: 2 messages suppressed by rate limit\n"; cw.String() != want {
+		t.Errorf("output = %q, want %q", cw.String(), want)
+	}
+
+	// Sync writes it right away.
+	cw.Reset()
+	clock := &fakeClock{t: time.Now()}
+	lc.limits[Warn].now = clock.now
+	for i := 0; i < 3; i++ {
+		l.Warn("flood")
+	}
+	lc.Sync()
+	if want := "WARN: flood\nWARN: 2 messages suppressed by rate limit\n"; cw.String() != want {
+		t.Errorf("output after Sync = %q, want %q", cw.String(), want)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "runtime"
+import "strings"
+import "net/http"
+import "runtime/debug"
+
+// Recover recovers from a panic and logs the panic value and a stack trace to the error level. It must be called
+// directly with defer:
+//
+//	defer l.Recover()
+//
+// If the config the logger was created from has Repanic set, Recover panics again with the same value after
+// logging it.
+func (l *Logger) Recover() {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	l.logPanic(v)
+	if l.repanic {
+		panic(v)
+	}
+}
+
+// RecoverHTTP is like Recover, but also responds with a 500 Internal Server Error. It must be called directly
+// with defer, and it is up to you to make sure nothing has been written to w yet.
+//
+//	defer l.RecoverHTTP(w)
+func (l *Logger) RecoverHTTP(w http.ResponseWriter) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	l.logPanic(v)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if l.repanic {
+		panic(v)
+	}
+}
+
+// logPanic logs a recovered panic value. It must be called directly from Recover or RecoverHTTP.
+func (l *Logger) logPanic(v any) {
+	// Attribute the message to the code that panicked, which is the first frame past the runtime's panic handling.
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs) // Skip Callers, logPanic, and Recover.
+	frames := runtime.CallersFrames(pcs[:n])
+	depth := 3
+	for i := 3; ; i++ {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") && !strings.HasPrefix(f.Function, "internal/runtime") {
+			depth = i
+			break
+		}
+		if !more {
+			break
+		}
+	}
+
+	l.output(Err, depth, fmt.Sprintf("panic: %v\n%s", v, debug.Stack()))
+}
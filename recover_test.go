@@ -0,0 +1,105 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "log"
+import "fmt"
+import "bytes"
+import "strings"
+import "testing"
+import "net/http"
+import "net/http/httptest"
+
+func TestRecover(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).Writer(Err, buf).Flags(log.Lshortfile).LogSessionStart(false).NewSessionLoggerWithID("ep", "abc")
+
+	var at int
+	func() {
+		defer l.Recover()
+		at = line() + 1
+		panic("the floor is lava")
+	}()
+
+	out := buf.String()
+	want := fmt.Sprintf(" ERR@ep:abc: recover_test.go:%d: panic: the floor is lava\n", at)
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("output does not start with %q:\n%s", want, out)
+	}
+	if !strings.Contains(out, "goroutine ") || !strings.Contains(out, "TestRecover") {
+		t.Errorf("output has no stack trace:\n%s", out)
+	}
+}
+
+func TestRecoverRepanic(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := &Config{Repanic: true}
+	l := lc.Writer(Err, buf).Flags(NoFlags).LogSessionStart(false).NewMasterLogger()
+
+	var got any
+	func() {
+		defer func() { got = recover() }()
+		defer l.Recover()
+		panic(42)
+	}()
+
+	if got != 42 {
+		t.Errorf("repanicked with %v, want 42", got)
+	}
+	if !strings.HasPrefix(buf.String(), " ERR: panic: 42\n") {
+		t.Errorf("output %q", buf.String())
+	}
+}
+
+func TestRecoverHTTP(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Err, buf).Flags(NoFlags).LogSessionStart(false)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := lc.NewSessionLoggerWithID("/boom", "req1")
+		defer l.RecoverHTTP(w)
+		var m map[string]int
+		m["nil map"]++
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/boom", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %v, want 500", rec.Code)
+	}
+	if !strings.HasPrefix(buf.String(), " ERR@/boom:req1: panic: assignment to entry in nil map\n") {
+		t.Errorf("output %q", buf.String())
+	}
+}
+
+func TestRecoverNoPanic(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).Writer(Err, buf).LogSessionStart(false).NewMasterLogger()
+
+	func() {
+		defer l.Recover()
+	}()
+	if buf.Len() != 0 {
+		t.Errorf("logged %q without a panic", buf.String())
+	}
+}
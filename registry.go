@@ -0,0 +1,98 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "sync"
+
+var registryLock sync.RWMutex
+var registry = map[string][]*Logger{} // Live loggers for each ID, in the order they were registered.
+
+// register adds l to the registry, and to the live loggers of lc. If a logger with the same ID is already
+// registered it stays first, so a reused ID (such as one from a request header) cannot take over the session of
+// another logger.
+func register(lc *Config, l *Logger) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[l.ID] = append(registry[l.ID], l)
+	if lc.live == nil {
+		lc.live = map[*Logger]struct{}{}
+	}
+	lc.live[l] = struct{}{}
+	l.source = lc
+}
+
+// LoggerByID looks up a registered session logger by its ID. Only loggers created from a config with Register
+// set are registered. If more than one logger with the same ID is live, the first one registered is returned
+// until it is released, then the next, and so on.
+func LoggerByID(id string) (*Logger, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	loggers := registry[id]
+	if len(loggers) == 0 {
+		return nil, false
+	}
+	return loggers[0], true
+}
+
+// Release removes the logger from the registry. The logger itself is still usable afterwards. It is safe to
+// call Release on loggers that were never registered, and to call it more than once.
+func (l *Logger) Release() {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	loggers := registry[l.ID]
+	for i, rl := range loggers {
+		if rl == l {
+			loggers = append(loggers[:i:i], loggers[i+1:]...)
+			break
+		}
+	}
+	if len(loggers) == 0 {
+		delete(registry, l.ID)
+	} else {
+		registry[l.ID] = loggers
+	}
+	if l.source != nil {
+		delete(l.source.live, l)
+		l.source = nil
+	}
+}
+
+// ForEachLogger calls fn for every registered session logger created from this config that has not been released,
+// for making changes to all of them at once (such as turning on the debug level with SetLevelEnabled). Only
+// loggers created while Register was set are included. The loggers are visited in no particular order, and fn
+// may release them.
+func (lc *Config) ForEachLogger(fn func(*Logger)) {
+	registryLock.RLock()
+	all := make([]*Logger, 0, len(lc.live))
+	for l := range lc.live {
+		all = append(all, l)
+	}
+	registryLock.RUnlock()
+
+	for _, l := range all {
+		fn(l)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "strings"
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	lc := &Config{Register: true}
+	lc.Writer(Info, io.Discard).LogSessionStart(false)
+
+	l := lc.NewSessionLoggerWithID("ep", "registry-test")
+	if got, ok := LoggerByID("registry-test"); !ok || got != l {
+		t.Fatalf("LoggerByID = %p, %v, want %p", got, ok, l)
+	}
+
+	l.Release()
+	l.Release()
+	if _, ok := LoggerByID("registry-test"); ok {
+		t.Errorf("logger still registered after Release")
+	}
+	l.Info("still usable")
+}
+
+func TestRegistryOptIn(t *testing.T) {
+	l := (&Config{}).LogSessionStart(false).NewSessionLoggerWithID("ep", "registry-opt-in")
+	defer l.Release()
+
+	if _, ok := LoggerByID("registry-opt-in"); ok {
+		t.Errorf("logger registered without Register set")
+	}
+}
+
+func TestRegistryDuplicateID(t *testing.T) {
+	lc := &Config{Register: true}
+	lc.LogSessionStart(false)
+
+	first := lc.NewSessionLoggerWithID("ep", "registry-dup")
+	second := lc.NewSessionLoggerWithID("ep", "registry-dup")
+
+	if got, _ := LoggerByID("registry-dup"); got != first {
+		t.Errorf("second logger with the same ID replaced the first")
+	}
+
+	// Releasing the second does not remove the first.
+	second.Release()
+	if got, _ := LoggerByID("registry-dup"); got != first {
+		t.Errorf("releasing the second logger removed the first")
+	}
+	first.Release()
+	if _, ok := LoggerByID("registry-dup"); ok {
+		t.Errorf("logger still registered after both were released")
+	}
+
+	// Releasing the first promotes the next live logger with the same ID.
+	first = lc.NewSessionLoggerWithID("ep", "registry-dup")
+	second = lc.NewSessionLoggerWithID("ep", "registry-dup")
+	first.Release()
+	if got, ok := LoggerByID("registry-dup"); !ok || got != second {
+		t.Errorf("second logger not found after the first was released")
+	}
+	second.Release()
+	if _, ok := LoggerByID("registry-dup"); ok {
+		t.Errorf("logger still registered after both were released")
+	}
+}
+
+func TestForEachLogger(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := &Config{Register: true}
+	lc.Writer(Debug, cw).Disable(Debug).Flags(NoFlags).LogSessionStart(false)
+	other := &Config{Register: true}
+	other.Writer(Debug, cw).Disable(Debug).LogSessionStart(false)
+
+	loggers := lc.NewSessionLoggers("a", "b", "c")
+	unrelated := other.NewSessionLogger("x")
+	defer unrelated.Release()
+	loggers["c"].Release()
+
+	seen := 0
+	lc.ForEachLogger(func(l *Logger) {
+		seen++
+		l.SetLevelEnabled(Debug, true)
+	})
+	if seen != 2 {
+		t.Errorf("visited %d loggers, want 2", seen)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		loggers[name].Debug(name)
+	}
+	unrelated.Debug("x")
+	got := cw.Lines()
+	if len(got) != 2 || !strings.HasSuffix(got[0], ": a") || !strings.HasSuffix(got[1], ": b") {
+		t.Errorf("debug enabled on the wrong loggers: %q", got)
+	}
+
+	// fn may release the loggers it is given.
+	lc.ForEachLogger(func(l *Logger) { l.Release() })
+	lc.ForEachLogger(func(l *Logger) { t.Errorf("logger %q still live after being released", l.ID) })
+}
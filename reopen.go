@@ -0,0 +1,168 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "sync"
+import "time"
+import "errors"
+import "strings"
+import "path/filepath"
+
+// reopenFile is the indirection used for every file given to Config.Writer or Config.TeeAtLevel, so that
+// ReopenFile can point loggers that already exist at a new file.
+type reopenFile struct {
+	lock sync.RWMutex
+	f    *os.File
+}
+
+// reopenable wraps any files in writers (other than the standard streams) in a reopenFile.
+func reopenable(writers []io.Writer) []io.Writer {
+	out := make([]io.Writer, len(writers))
+	for i, w := range writers {
+		out[i] = w
+		if f, ok := w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+			out[i] = &reopenFile{f: f}
+		}
+	}
+	return out
+}
+
+func (rf *reopenFile) Write(p []byte) (int, error) {
+	rf.lock.RLock()
+	defer rf.lock.RUnlock()
+
+	return rf.f.Write(p)
+}
+
+// swap replaces the file and returns the old one. Writes in progress finish before the swap is made, so the old
+// file may be closed as soon as this returns.
+func (rf *reopenFile) swap(f *os.File) *os.File {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	old := rf.f
+	rf.f = f
+	return old
+}
+
+// file returns the current file.
+func (rf *reopenFile) file() *os.File {
+	rf.lock.RLock()
+	defer rf.lock.RUnlock()
+
+	return rf.f
+}
+
+func (rf *reopenFile) unwrap() []io.Writer {
+	rf.lock.RLock()
+	defer rf.lock.RUnlock()
+
+	return []io.Writer{rf.f}
+}
+
+// ReopenFile creates a new log file in logdir and switches every level that writes to a file over to it,
+// including in loggers that have already been created from this config. The old files are closed once nothing
+// is writing to them. This is meant for use with external rotation tools like logrotate, which expect the
+// program to reopen its log file when it gets SIGHUP.
+//
+// Only files given to Writer or TeeAtLevel (including by NewFileConfig) are switched, files set in the Writers
+// field directly or wrapped in other writers are left alone. Each old file gets its own new file, so a config
+// from NewSplitFileConfig still has one file per level afterwards. The new files are named for the current time
+// like the old ones, keeping any part of the old name that follows the time (such as "-warn"). A new file is
+// never the same as an old one, even if the name would be, instead a numeric suffix is added.
+func (lc *Config) ReopenFile(logdir string) error {
+	lc.lock.RLock()
+	files := []*reopenFile{}
+	for _, w := range flatWriters(lc.allWriters()...) {
+		if rf, ok := w.(*reopenFile); ok {
+			files = append(files, rf)
+		}
+	}
+	lc.lock.RUnlock()
+
+	if len(files) == 0 {
+		return errors.New("sessionlogger: there is no log file to reopen")
+	}
+
+	// Create every new file before switching any, so a failure leaves the config as it was.
+	now := time.Now()
+	repl := map[*os.File]*os.File{}
+	for _, rf := range files {
+		cur := rf.file()
+		if repl[cur] != nil {
+			continue
+		}
+		f, err := createUniqueLogFile(logdir, now, reopenSuffix(cur.Name()))
+		if err != nil {
+			for _, f := range repl {
+				f.Close()
+			}
+			return err
+		}
+		repl[cur] = f
+	}
+
+	old := []io.Writer{}
+	for _, rf := range files {
+		cur := rf.file()
+		if f := repl[cur]; f != nil {
+			old = append(old, rf.swap(f))
+		}
+	}
+	return closeWriters(old...)
+}
+
+// reopenSuffix returns the part of the name of a log file that ReopenFile keeps: whatever follows the time in
+// names made with logFileLayout (without the extension or a numeric suffix added by createUniqueLogFile), or the
+// whole name without the extension, after a dash, for other names.
+func reopenSuffix(name string) string {
+	name = filepath.Base(name)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+
+	if len(name) < len(logFileLayout) {
+		return "-" + name
+	}
+	if _, err := time.Parse(logFileLayout, name[:len(logFileLayout)]); err != nil {
+		return "-" + name
+	}
+	suffix := name[len(logFileLayout):]
+	if i := strings.LastIndexByte(suffix, '-'); i >= 0 && isDigits(suffix[i+1:]) {
+		suffix = suffix[:i]
+	}
+	return suffix
+}
+
+// isDigits reports if s is made up of one or more ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "testing"
+
+func TestReopenFile(t *testing.T) {
+	dir := t.TempDir()
+	f, err := CreateLogFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := (&Config{}).Writer(Info, f, os.Stdout).Writer(Warn, f).Flags(NoFlags).LogSessionStart(false)
+	defer lc.Close()
+	before := lc.NewSessionLoggerWithID("ep", "abc")
+
+	before.Warn("one")
+	if err := lc.ReopenFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	before.Warn("two")
+	lc.NewSessionLoggerWithID("ep", "def").Warn("three")
+
+	names := lc.LogFiles()
+	if len(names) != 1 || names[0] == f.Name() {
+		t.Fatalf("LogFiles() = %q after reopening %q", names, f.Name())
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Errorf("old file was not closed")
+	}
+
+	old, _ := os.ReadFile(f.Name())
+	if string(old) != "WARN@ep:abc: one\n" {
+		t.Errorf("old file contains %q", old)
+	}
+	cur, _ := os.ReadFile(names[0])
+	if string(cur) != "WARN@ep:abc: two\nWARN@ep:def: three\n" {
+		t.Errorf("new file contains %q", cur)
+	}
+}
+
+func TestReopenFileWithoutFile(t *testing.T) {
+	lc := (&Config{}).Writer(Info, &CaptureWriter{})
+	if err := lc.ReopenFile(t.TempDir()); err == nil {
+		t.Errorf("ReopenFile worked without a file")
+	}
+}
+
+func TestReopenSplitFiles(t *testing.T) {
+	dir := t.TempDir()
+	lc, closeAll, err := NewSplitFileConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAll()
+	lc.NoConsole().Flags(NoFlags).LogSessionStart(false)
+	defer lc.Close()
+
+	if err := lc.ReopenFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	l := lc.NewMasterLogger()
+	l.Info("i")
+	l.Warn("w")
+	l.Err("e")
+
+	names := lc.LogFiles()
+	if len(names) != 3 {
+		t.Fatalf("LogFiles() = %q, want one file per level", names)
+	}
+	want := map[string]string{"-info": "INFO: i\n", "-warn": "WARN: w\n", "-err": " ERR: e\n"}
+	for _, name := range names {
+		suffix := reopenSuffix(name)
+		got, _ := os.ReadFile(name)
+		if string(got) != want[suffix] {
+			t.Errorf("%v contains %q, want %q", name, got, want[suffix])
+		}
+		delete(want, suffix)
+	}
+	if len(want) != 0 {
+		t.Errorf("no new files for %q", want)
+	}
+}
+
+func TestReopenSuffix(t *testing.T) {
+	cases := map[string]string{
+		"logs/m01-d02-t150405.log":        "",
+		"logs/m01-d02-t150405-3.log":      "",
+		"logs/m01-d02-t150405-warn.log":   "-warn",
+		"logs/m01-d02-t150405-warn-1.log": "-warn",
+		"logs/app.log":                    "-app",
+	}
+	for name, want := range cases {
+		if got := reopenSuffix(name); got != want {
+			t.Errorf("reopenSuffix(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "sync"
+import "bytes"
+
+// maxRingPartial is the most a RingBufferWriter keeps of a line that has not been finished. Once a partial line
+// reaches this size it is added as a line of its own, as if a line ending had been written.
+const maxRingPartial = 64 * 1024
+
+// RingBufferWriter is an io.Writer that keeps the most recent lines written to it in memory, for showing recent
+// log messages on a status page or the like. Writes do not have to line up with lines, a line is only added once
+// its line ending has been written, or once it reaches 64 KiB, so a writer that never ends its lines cannot use
+// up memory. It is safe for concurrent use.
+type RingBufferWriter struct {
+	lock    sync.Mutex
+	lines   []string
+	next    int  // Index in lines the next line goes to.
+	full    bool // If true, every entry in lines is used and lines[next] is the oldest.
+	partial []byte
+}
+
+// NewRingBufferWriter creates a RingBufferWriter that keeps the last n lines. Will panic if n is less than 1.
+func NewRingBufferWriter(n int) *RingBufferWriter {
+	if n < 1 {
+		panic("Ring buffer size must be at least 1.")
+	}
+	return &RingBufferWriter{lines: make([]string, n)}
+}
+
+// Write adds every complete line in p to the buffer, throwing away the oldest lines if it is full. Anything
+// after the last line ending is kept until the rest of the line is written, unless it grows too long.
+func (rb *RingBufferWriter) Write(p []byte) (int, error) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	rest := p
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := string(rest[:i])
+		if len(rb.partial) > 0 {
+			line = string(rb.partial) + line
+			rb.partial = rb.partial[:0]
+		}
+		rb.add(line)
+		rest = rest[i+1:]
+	}
+	for len(rb.partial)+len(rest) >= maxRingPartial {
+		n := maxRingPartial - len(rb.partial)
+		rb.add(string(rb.partial) + string(rest[:n]))
+		rb.partial = rb.partial[:0]
+		rest = rest[n:]
+	}
+	rb.partial = append(rb.partial, rest...)
+	return len(p), nil
+}
+
+// add must be called with the lock held.
+func (rb *RingBufferWriter) add(line string) {
+	rb.lines[rb.next] = line
+	rb.next++
+	if rb.next == len(rb.lines) {
+		rb.next = 0
+		rb.full = true
+	}
+}
+
+// Lines returns the lines in the buffer, oldest first, without the line endings. A line that has not been
+// finished yet is not included.
+func (rb *RingBufferWriter) Lines() []string {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	if !rb.full {
+		return append([]string{}, rb.lines[:rb.next]...)
+	}
+	return append(append([]string{}, rb.lines[rb.next:]...), rb.lines[:rb.next]...)
+}
+
+// WriteTo writes the lines in the buffer to w, oldest first, each followed by a line ending. The buffer is not
+// locked while writing to w, so a slow writer does not hold up logging.
+func (rb *RingBufferWriter) WriteTo(w io.Writer) (int64, error) {
+	buf := bytes.Buffer{}
+	for _, line := range rb.Lines() {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.WriteTo(w)
+}
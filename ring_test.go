@@ -0,0 +1,138 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "sync"
+import "bytes"
+import "strings"
+import "testing"
+
+func TestRingBufferWraparound(t *testing.T) {
+	rb := NewRingBufferWriter(3)
+
+	steps := []struct {
+		write string
+		want  string // Lines joined with "|".
+	}{
+		{"", ""},
+		{"a\n", "a"},
+		{"b\nc\n", "a|b|c"},
+		{"d\n", "b|c|d"},
+		{"e\nf\ng\nh\n", "f|g|h"},
+		{"par", "f|g|h"},
+		{"tial\nnext", "g|h|partial"},
+		{"\n", "h|partial|next"},
+		{strings.Repeat("x", 10000) + "\n", "partial|next|" + strings.Repeat("x", 10000)},
+	}
+	for i, s := range steps {
+		rb.Write([]byte(s.write))
+		if got := strings.Join(rb.Lines(), "|"); got != s.want {
+			t.Errorf("step %d: lines %.40q, want %.40q", i, got, s.want)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := rb.WriteTo(buf)
+	if err != nil || n != int64(buf.Len()) || buf.String() != "partial\nnext\n"+strings.Repeat("x", 10000)+"\n" {
+		t.Errorf("WriteTo wrote %d bytes (%v): %.40q", n, err, buf.String())
+	}
+}
+
+func TestRingBufferLongPartial(t *testing.T) {
+	rb := NewRingBufferWriter(8)
+
+	// A line that never ends is broken up instead of growing without bound, whether it comes in small writes or
+	// a single large one.
+	chunk := strings.Repeat("x", 1000)
+	n := 2*maxRingPartial/len(chunk) + 1
+	for i := 0; i < n; i++ {
+		rb.Write([]byte(chunk))
+	}
+	rb.Write([]byte("\n"))
+	rb.Write([]byte(strings.Repeat("y", 3*maxRingPartial)))
+
+	got := []int{}
+	for _, line := range rb.Lines() {
+		got = append(got, len(line))
+	}
+	rest := n*len(chunk) - 2*maxRingPartial
+	want := []int{maxRingPartial, maxRingPartial, rest, maxRingPartial, maxRingPartial, maxRingPartial}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("line lengths %v, want %v", got, want)
+	}
+	if len(rb.partial) != 0 || cap(rb.partial) > 2*maxRingPartial {
+		t.Errorf("partial line kept %d bytes, capacity %d", len(rb.partial), cap(rb.partial))
+	}
+}
+
+// Run with -race.
+func TestRingBufferConcurrent(t *testing.T) {
+	rb := NewRingBufferWriter(16)
+	l := (&Config{}).Writer(Info, rb).Flags(NoFlags).LogSessionStart(false).NewMasterLogger()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Infof("writer %d line %d", i, j)
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, line := range rb.Lines() {
+					if !strings.HasPrefix(line, "INFO: writer ") {
+						t.Errorf("read a torn line %q", line)
+						return
+					}
+				}
+				rb.WriteTo(&bytes.Buffer{})
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := rb.Lines()
+	if len(lines) != 16 {
+		t.Fatalf("%d lines kept, want 16", len(lines))
+	}
+
+	// The lines from each writer must still be in order.
+	last := map[int]int{}
+	for _, line := range lines {
+		var w, n int
+		if _, err := fmt.Sscanf(line, "INFO: writer %d line %d", &w, &n); err != nil {
+			t.Fatalf("bad line %q", line)
+		}
+		if prev, ok := last[w]; ok && n <= prev {
+			t.Errorf("line %d of writer %d came after line %d", n, w, prev)
+		}
+		last[w] = n
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "sync"
+import "time"
+import "strconv"
+import "path/filepath"
+import "compress/gzip"
+
+// RotatingWriter is an io.Writer that writes to log files in a directory, starting a new file whenever the
+// current one would grow past a maximum size, and optionally when a time boundary is crossed. Files are named the
+// same way as CreateLogFile names them.
+//
+// A RotatingWriter is safe for concurrent use, so it may be shared between any number of loggers.
+type RotatingWriter struct {
+	logdir  string
+	maxSize int64
+
+	now func() time.Time
+
+	lock     sync.Mutex
+	f        *os.File
+	size     int64
+	interval time.Duration
+	daily    bool
+	next     time.Time // Zero if there is no time based rotation.
+	compress bool
+
+	jobs   sync.WaitGroup // Running compression jobs and trigger goroutines.
+	closed chan struct{}  // Closed by Close, to stop the trigger goroutines.
+}
+
+// maxCompressJobs is the maximum number of files that will be compressed at the same time.
+const maxCompressJobs = 2
+
+var compressSlots = make(chan struct{}, maxCompressJobs)
+
+// NewRotatingWriter creates a RotatingWriter that writes to files in logdir, creating the directory if needed.
+// When a write would push the current file past maxSize bytes, the file is closed and a new one is started.
+// A single write larger than maxSize is written anyway, to a fresh file. If maxSize is 0 or less files are
+// never rotated based on size.
+func NewRotatingWriter(logdir string, maxSize int64) (*RotatingWriter, error) {
+	rw := &RotatingWriter{
+		logdir:  logdir,
+		maxSize: maxSize,
+		now:     time.Now,
+		closed:  make(chan struct{}),
+	}
+
+	err := rw.rotate()
+	if err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// Write writes p to the current log file, rotating first if needed.
+func (rw *RotatingWriter) Write(p []byte) (int, error) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	if rw.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	timeUp := !rw.next.IsZero() && !rw.now().Before(rw.next)
+	full := rw.maxSize > 0 && rw.size > 0 && rw.size+int64(len(p)) > rw.maxSize
+	if timeUp || full {
+		err := rw.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rw.f.Write(p)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Interval makes the writer start a new file every time a multiple of d is crossed. Boundaries are aligned to
+// the zero time (so an interval of one hour rotates on the hour, UTC). The check is done when writing, so no
+// background goroutine is involved and an idle writer will not create empty files. An interval of 0 turns
+// time based rotation off.
+func (rw *RotatingWriter) Interval(d time.Duration) *RotatingWriter {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	rw.interval = d
+	rw.daily = false
+	rw.next = rw.nextRollover(rw.now())
+	return rw
+}
+
+// Daily makes the writer start a new file at every local midnight. Like Interval the check is done when writing.
+func (rw *RotatingWriter) Daily() *RotatingWriter {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	rw.interval = 0
+	rw.daily = true
+	rw.next = rw.nextRollover(rw.now())
+	return rw
+}
+
+func (rw *RotatingWriter) nextRollover(t time.Time) time.Time {
+	switch {
+	case rw.daily:
+		y, m, d := t.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+	case rw.interval > 0:
+		return t.Truncate(rw.interval).Add(rw.interval)
+	}
+	return time.Time{}
+}
+
+// Compress turns on compression of old files. After a file is rotated out it is compressed to a file with the
+// same name plus ".gz" in the background, and the original is deleted. Failures are logged to Stderr, and leave
+// the original file in place. Close waits for any compression in progress to finish.
+func (rw *RotatingWriter) Compress(on bool) *RotatingWriter {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	rw.compress = on
+	return rw
+}
+
+// RotateOn makes the writer start a new file every time a value is received from trigger, no matter how big the
+// current file is or how long it has been open, so rotation can be controlled by something else. The channel is
+// read by a goroutine that exits when the writer is closed or the channel is. Failures are logged to Stderr.
+func (rw *RotatingWriter) RotateOn(trigger <-chan struct{}) *RotatingWriter {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	if rw.f == nil {
+		return rw
+	}
+
+	rw.jobs.Add(1)
+	go func() {
+		defer rw.jobs.Done()
+
+		for {
+			select {
+			case <-rw.closed:
+				return
+			case _, ok := <-trigger:
+				if !ok {
+					return
+				}
+				err := rw.Rotate()
+				if err != nil && err != os.ErrClosed {
+					selfLog.Printf("sessionlogger: rotating %v failed: %v", rw.logdir, err)
+				}
+			}
+		}
+	}()
+	return rw
+}
+
+// Rotate closes the current file and starts a new one.
+func (rw *RotatingWriter) Rotate() error {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	if rw.f == nil {
+		return os.ErrClosed
+	}
+	return rw.rotate()
+}
+
+// Name returns the path of the file currently being written to.
+func (rw *RotatingWriter) Name() string {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	if rw.f == nil {
+		return ""
+	}
+	return rw.f.Name()
+}
+
+// Sync commits the current file to stable storage.
+func (rw *RotatingWriter) Sync() error {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	if rw.f == nil {
+		return nil
+	}
+	return rw.f.Sync()
+}
+
+// Close closes the current file and waits for any old files to finish compressing. Writes after Close return an
+// error.
+func (rw *RotatingWriter) Close() error {
+	defer rw.jobs.Wait()
+
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	if rw.f == nil {
+		return nil
+	}
+	close(rw.closed)
+	err := rw.f.Close()
+	rw.f = nil
+	return err
+}
+
+// rotate must be called with the lock held.
+func (rw *RotatingWriter) rotate() error {
+	t := rw.now()
+	f, err := createUniqueLogFile(rw.logdir, t, "")
+	if err != nil {
+		return err
+	}
+
+	if rw.f != nil {
+		err := rw.f.Close()
+		if err == nil && rw.compress {
+			rw.startCompress(rw.f.Name())
+		}
+	}
+	rw.f = f
+	rw.size = 0
+	rw.next = rw.nextRollover(t)
+	return nil
+}
+
+func (rw *RotatingWriter) startCompress(name string) {
+	rw.jobs.Add(1)
+	go func() {
+		defer rw.jobs.Done()
+
+		compressSlots <- struct{}{}
+		defer func() { <-compressSlots }()
+
+		err := compressFile(name)
+		if err != nil {
+			selfLog.Printf("sessionlogger: compressing %v failed: %v", name, err)
+		}
+	}()
+}
+
+// compressFile compresses the named file to name+".gz", and removes the original if that worked.
+func compressFile(name string) (err error) {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	gw := gzip.NewWriter(out)
+	_, err = io.Copy(gw, in)
+	if err != nil {
+		return err
+	}
+	err = gw.Close()
+	if err != nil {
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	in.Close()
+	return os.Remove(name)
+}
+
+// createUniqueLogFile creates a new log file named for the given time, followed by suffix (which may be empty).
+// Unlike CreateLogFile it will never truncate an existing file (or one that was compressed), instead a numeric
+// suffix is added to the name.
+func createUniqueLogFile(logdir string, t time.Time, suffix string) (*os.File, error) {
+	err := makeLogDir(logdir, 0775)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Join(logdir, t.UTC().Format(logFileLayout)+suffix)
+	name := base + ".log"
+	for i := 1; ; i++ {
+		// A compressed copy counts as the file existing, otherwise compressing the new file would fail.
+		_, err := os.Stat(name + ".gz")
+		if err != nil {
+			f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+			if !os.IsExist(err) {
+				return f, err
+			}
+		}
+		name = base + "-" + strconv.Itoa(i) + ".log"
+	}
+}
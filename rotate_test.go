@@ -0,0 +1,220 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "sync"
+import "time"
+import "strings"
+import "testing"
+import "compress/gzip"
+
+import "go.uber.org/goleak"
+
+// fakeClock is a clock for RotatingWriter.now that only moves when told to.
+type fakeClock struct {
+	t time.Time
+}
+
+func (fc *fakeClock) now() time.Time {
+	return fc.t
+}
+
+func logFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestRotatingWriterInterval(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{t: time.Date(2024, 3, 1, 10, 59, 0, 0, time.UTC)}
+
+	rw, err := NewRotatingWriter(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+	rw.now = clock.now
+	rw.Interval(time.Hour)
+
+	steps := []struct {
+		at    time.Duration // After the start time.
+		files int
+	}{
+		{0, 1},
+		{59 * time.Second, 1},
+		{60 * time.Second, 2}, // 11:00 exactly.
+		{61 * time.Second, 2},
+		{30 * time.Minute, 2},
+		{61 * time.Minute, 3}, // 12:00 has passed.
+	}
+	start := clock.t
+	for _, s := range steps {
+		clock.t = start.Add(s.at)
+		_, err := rw.Write([]byte("x\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(logFiles(t, dir)); got != s.files {
+			t.Fatalf("at %v: %v files, want %v", clock.t.Format("15:04:05"), got, s.files)
+		}
+	}
+}
+
+func TestRotatingWriterDaily(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{t: time.Date(2024, 3, 1, 23, 0, 0, 0, time.Local)}
+
+	rw, err := NewRotatingWriter(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+	rw.now = clock.now
+	rw.Daily()
+
+	rw.Write([]byte("late\n"))
+	clock.t = clock.t.Add(time.Hour)
+	rw.Write([]byte("midnight\n"))
+	day := clock.t.UTC().Format("m01-d02") // Files are named in UTC.
+	clock.t = clock.t.Add(23 * time.Hour)
+	rw.Write([]byte("still the same day\n"))
+
+	if got := len(logFiles(t, dir)); got != 2 {
+		t.Errorf("%v files, want 2", got)
+	}
+	if !strings.Contains(rw.Name(), day) {
+		t.Errorf("current file %v is not named for the second day", rw.Name())
+	}
+}
+
+func TestRotatingWriterCompress(t *testing.T) {
+	dir := t.TempDir()
+	rw, err := NewRotatingWriter(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Compress(true)
+
+	content := strings.Repeat("compress me please\n", 100)
+	rw.Write([]byte(content))
+	old := rw.Name()
+	if err := rw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rw.Write([]byte("new file\n"))
+	cur := rw.Name()
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("original file still there after compressing: %v", err)
+	}
+	f, err := os.Open(old + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("not a gzip file: %v", err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil || string(b) != content {
+		t.Errorf("decompressed %d bytes (%v), want the %d written", len(b), err, len(content))
+	}
+
+	if b, _ := os.ReadFile(cur); string(b) != "new file\n" {
+		t.Errorf("current file contains %q", b)
+	}
+}
+
+func TestRotatingWriterRotateOn(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	dir := t.TempDir()
+	rw, err := NewRotatingWriter(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger := make(chan struct{})
+	rw.RotateOn(trigger)
+
+	// Keep writing while the triggers arrive, for the race detector.
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				rw.Write([]byte("busy\n"))
+			}
+		}
+	}()
+
+	first := rw.Name()
+	trigger <- struct{}{}
+	trigger <- struct{}{} // Not received until the first rotation is done.
+	close(stop)
+	wg.Wait()
+
+	if rw.Name() == first {
+		t.Errorf("still writing to %v", first)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(logFiles(t, dir)); got < 2 {
+		t.Errorf("%v files, want at least 2", got)
+	}
+}
+
+func TestRotatingWriterRotateOnClosedChannel(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	rw, err := NewRotatingWriter(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	trigger := make(chan struct{})
+	rw.RotateOn(trigger)
+	close(trigger)
+	rw.jobs.Wait()
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+// Package sessionotel creates session loggers that use the OpenTelemetry trace and span IDs from a context as
+// their session ID, so log messages can be matched up with traces. It is a separate package so programs that
+// do not use OpenTelemetry do not need to depend on it.
+package sessionotel
+
+import "context"
+
+import "go.opentelemetry.io/otel/trace"
+
+import "github.com/milochristiansen/sessionlogger"
+
+// NewSessionLoggerFromContext creates a session logger from sessionlogger.DefaultConfig. If ctx carries a valid
+// span context the session ID is the trace ID and span ID joined with a dash (so a message is prefixed with
+// "@endpoint:traceid-spanid"), otherwise a normal random ID is used.
+func NewSessionLoggerFromContext(ctx context.Context, endpoint string) *sessionlogger.Logger {
+	return sessionlogger.DefaultConfigSnapshot().NewSessionLoggerWithID(endpoint, ID(ctx))
+}
+
+// NewConfigSessionLoggerFromContext is NewSessionLoggerFromContext with a specific config.
+func NewConfigSessionLoggerFromContext(ctx context.Context, lc *sessionlogger.Config, endpoint string) *sessionlogger.Logger {
+	return lc.NewSessionLoggerWithID(endpoint, ID(ctx))
+}
+
+// ID returns the session ID for the span context in ctx, or an empty string if there is no valid span context.
+func ID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String() + "-" + sc.SpanID().String()
+}
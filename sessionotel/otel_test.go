@@ -0,0 +1,64 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionotel
+
+import "context"
+import "testing"
+
+import "go.opentelemetry.io/otel/trace"
+
+import "github.com/milochristiansen/sessionlogger"
+
+func TestSessionLoggerFromContext(t *testing.T) {
+	tid, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	sid, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	cw := &sessionlogger.CaptureWriter{}
+	lc := (&sessionlogger.Config{}).Writer(sessionlogger.Info, cw).Flags(sessionlogger.NoFlags).LogSessionStart(false)
+
+	l := NewConfigSessionLoggerFromContext(ctx, lc, "/api")
+	l.Info("traced")
+
+	const want = "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"
+	if l.ID != want {
+		t.Errorf("ID = %q, want %q", l.ID, want)
+	}
+	if cw.String() != "INFO@/api:"+want+": traced\n" {
+		t.Errorf("output %q", cw.String())
+	}
+}
+
+func TestSessionLoggerWithoutSpan(t *testing.T) {
+	lc := (&sessionlogger.Config{}).LogSessionStart(false)
+
+	if id := ID(context.Background()); id != "" {
+		t.Errorf("ID without a span = %q", id)
+	}
+	a := NewConfigSessionLoggerFromContext(context.Background(), lc, "/api")
+	b := NewConfigSessionLoggerFromContext(context.Background(), lc, "/api")
+	if a.ID == "" || a.ID == b.ID {
+		t.Errorf("fallback IDs = %q and %q", a.ID, b.ID)
+	}
+}
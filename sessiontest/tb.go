@@ -0,0 +1,77 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+// Package sessiontest routes log messages to the test log, so the output of code under test shows up with the
+// test that produced it. It is a separate package so the main package does not import testing.
+package sessiontest
+
+import "log"
+import "strings"
+import "testing"
+import "sync/atomic"
+
+import "github.com/milochristiansen/sessionlogger"
+
+// NewTBConfig returns a config that writes every level to tb.Log, without the session start message. The date
+// and time are left out, since the test log has its own ordering.
+//
+// Messages written after the test has finished, such as from goroutines the test did not wait for, are thrown
+// away instead of making tb.Log panic.
+func NewTBConfig(tb testing.TB) *sessionlogger.Config {
+	tw := &tbWriter{tb: tb}
+	tb.Cleanup(func() { tw.done.Store(true) })
+
+	return (&sessionlogger.Config{}).
+		Writer(sessionlogger.Debug, tw).
+		Writer(sessionlogger.Info, tw).
+		Writer(sessionlogger.Warn, tw).
+		Writer(sessionlogger.Err, tw).
+		Flags(log.Lshortfile).
+		LogSessionStart(false)
+}
+
+// NewTBLogger creates a session logger named for the test that writes to tb.Log. See NewTBConfig.
+func NewTBLogger(tb testing.TB) *sessionlogger.Logger {
+	return NewTBConfig(tb).NewSessionLogger(tb.Name())
+}
+
+// tbWriter passes each write to tb.Log, without the line ending.
+type tbWriter struct {
+	tb   testing.TB
+	done atomic.Bool
+}
+
+func (tw *tbWriter) Write(p []byte) (n int, err error) {
+	if tw.done.Load() {
+		return len(p), nil
+	}
+
+	// There is a window between the test finishing and the cleanup running where tb.Log panics.
+	defer func() {
+		if recover() != nil {
+			n, err = len(p), nil
+		}
+	}()
+
+	tw.tb.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
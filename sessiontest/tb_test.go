@@ -0,0 +1,86 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessiontest
+
+import "fmt"
+import "strings"
+import "testing"
+
+// fakeTB records calls to Log and Cleanup. Log panics if panics is set, like a real one does after the test ends.
+type fakeTB struct {
+	testing.TB // Panics if anything else is used.
+
+	logs     []string
+	cleanups []func()
+	panics   bool
+}
+
+func (tb *fakeTB) Name() string { return "TestFake" }
+
+func (tb *fakeTB) Log(args ...any) {
+	if tb.panics {
+		panic("Log in goroutine after TestFake has completed")
+	}
+	tb.logs = append(tb.logs, fmt.Sprint(args...))
+}
+
+func (tb *fakeTB) Cleanup(fn func()) {
+	tb.cleanups = append(tb.cleanups, fn)
+}
+
+func TestNewTBLogger(t *testing.T) {
+	tb := &fakeTB{}
+	l := NewTBLogger(tb)
+
+	l.Info("hello")
+	l.Err("two\nlines")
+
+	if len(tb.logs) != 2 {
+		t.Fatalf("logged %q", tb.logs)
+	}
+	prefix := "@TestFake:" + l.ID + ": tb_test.go:"
+	if !strings.HasPrefix(tb.logs[0], "INFO"+prefix) || !strings.HasSuffix(tb.logs[0], ": hello") {
+		t.Errorf("first message %q", tb.logs[0])
+	}
+	if !strings.HasPrefix(tb.logs[1], " ERR"+prefix) || !strings.HasSuffix(tb.logs[1], ": two\nlines") {
+		t.Errorf("second message %q", tb.logs[1])
+	}
+}
+
+func TestTBLoggerAfterTest(t *testing.T) {
+	tb := &fakeTB{}
+	l := NewTBLogger(tb)
+
+	// Between the end of the test and the cleanup.
+	tb.panics = true
+	l.Info("late")
+
+	for _, fn := range tb.cleanups {
+		fn()
+	}
+	tb.panics = false
+	l.Info("after cleanup")
+	if len(tb.logs) != 0 {
+		t.Errorf("logged %q after the test", tb.logs)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "sync"
+import "syscall"
+import "os/signal"
+
+// defaultSignals are the signals HandleSignals handles if none are given.
+var defaultSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// raise sends sig to the process again after HandleSignals is done with it. It is a variable so it can be swapped
+// out when testing.
+var raise = func(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		// Some systems cannot send most signals to a process, so just exit.
+		exit(1)
+	}
+}
+
+// HandleSignals makes the program sync and close every writer used by lc (see Config.Sync and Config.Close) when
+// it gets one of the given signals (SIGINT and SIGTERM if none are given), so buffered output is not lost when
+// the program is killed. Once that is done the handler removes itself and the signal is sent again, so the
+// program terminates normally (unless something else is also handling the signal).
+//
+// Calling the returned function removes the handler without doing anything else. It is safe to call more than
+// once, and each call to HandleSignals sets up a separate handler.
+func HandleSignals(lc *Config, sigs ...os.Signal) (cancel func()) {
+	if len(sigs) == 0 {
+		sigs = defaultSignals
+	}
+
+	c := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(c, sigs...)
+
+	go func() {
+		select {
+		case sig := <-c:
+			signal.Stop(c)
+			err := lc.Sync()
+			if err != nil {
+				selfLog.Printf("sessionlogger: syncing writers on %v failed: %v", sig, err)
+			}
+			err = lc.Close()
+			if err != nil {
+				selfLog.Printf("sessionlogger: closing writers on %v failed: %v", sig, err)
+			}
+			raise(sig)
+		case <-stop:
+			signal.Stop(c)
+		}
+	}()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
@@ -0,0 +1,76 @@
+//go:build !windows && !plan9
+
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "time"
+import "syscall"
+import "testing"
+
+func TestHandleSignals(t *testing.T) {
+	raised := make(chan os.Signal, 1)
+	old := raise
+	raise = func(sig os.Signal) { raised <- sig }
+	defer func() { raise = old }()
+
+	cc := &closeCounter{}
+	lc := (&Config{}).Writer(Info, cc).Writer(Err, cc)
+	cancel := HandleSignals(lc, syscall.SIGUSR1)
+	defer cancel()
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case sig := <-raised:
+		if sig != syscall.SIGUSR1 {
+			t.Errorf("raised %v, want SIGUSR1", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the signal was not handled")
+	}
+	if cc.closed != 1 {
+		t.Errorf("writer closed %d times, want 1", cc.closed)
+	}
+}
+
+func TestHandleSignalsCancel(t *testing.T) {
+	old := raise
+	raise = func(sig os.Signal) { t.Errorf("raised %v after cancel", sig) }
+	defer func() { raise = old }()
+
+	cc := &closeCounter{}
+	lc := (&Config{}).Writer(Info, cc)
+	for i := 0; i < 10; i++ {
+		cancel := HandleSignals(lc, syscall.SIGUSR2)
+		cancel()
+		cancel()
+	}
+	if cc.closed != 0 {
+		t.Errorf("writer closed %d times without a signal", cc.closed)
+	}
+}
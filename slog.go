@@ -0,0 +1,154 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "strconv"
+import "strings"
+import "context"
+import "log/slog"
+
+// SlogHandler is a slog.Handler that writes records to a Logger. Attributes are appended to the message as
+// key=value pairs, with group names joined to the key by dots. Records below slog.LevelWarn (including
+// slog.LevelDebug) are written to the info level, use WithDebugLevel to send the ones below slog.LevelInfo to the
+// debug level instead.
+type SlogHandler struct {
+	l      *Logger
+	attrs  string // Preformatted attributes from WithAttrs, each with a leading space.
+	groups string // Group prefix for new attributes, for example "a.b.".
+	debug  bool   // If true, records below slog.LevelInfo go to the debug level.
+}
+
+var _ slog.Handler = (*SlogHandler)(nil)
+
+// NewSlogHandler creates a slog.Handler that writes to the given Logger. Use it with slog.New to get a
+// *slog.Logger that keeps the session prefix on every line.
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{l: l}
+}
+
+// NewSlogHandler creates a slog.Handler backed by a new master logger created from this config.
+func (lc *Config) NewSlogHandler() *SlogHandler {
+	return NewSlogHandler(lc.NewMasterLogger())
+}
+
+// WithDebugLevel returns a new handler that writes records below slog.LevelInfo to the debug level rather than
+// info, so they can be turned off along with the other debug messages.
+func (h *SlogHandler) WithDebugLevel() *SlogHandler {
+	nh := *h
+	nh.debug = true
+	return &nh
+}
+
+// level returns the level a record is written to.
+func (h *SlogHandler) level(level slog.Level) logLevel {
+	switch {
+	case level < slog.LevelInfo && h.debug:
+		return Debug
+	case level < slog.LevelWarn:
+		return Info
+	case level < slog.LevelError:
+		return Warn
+	default:
+		return Err
+	}
+}
+
+// Enabled reports false if the level the record would be written to is disabled.
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.l.enabled(h.level(level))
+}
+
+// Handle writes the record. The record time is ignored, the underlying logger adds its own timestamp. The file
+// and line (if the flags ask for them) come from the PC of the record, so they are right no matter how the
+// record reached the handler.
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	b := &strings.Builder{}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(b, h.groups, a)
+		return true
+	})
+
+	return h.l.outputPC(h.level(r.Level), r.PC, b.String())
+}
+
+// WithAttrs returns a new handler that appends the given attributes to every record.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendAttr(b, h.groups, a)
+	}
+
+	nh := *h
+	nh.attrs = b.String()
+	return &nh
+}
+
+// WithGroup returns a new handler that qualifies all following attributes with the group name.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	nh := *h
+	nh.groups = h.groups + name + "."
+	return &nh
+}
+
+func appendAttr(b *strings.Builder, groups string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if a.Key != "" {
+			groups = groups + a.Key + "."
+		}
+		for _, ga := range attrs {
+			appendAttr(b, groups, ga)
+		}
+		return
+	}
+
+	b.WriteString(" ")
+	b.WriteString(groups)
+	b.WriteString(a.Key)
+	b.WriteString("=")
+	b.WriteString(quoteValue(a.Value.String()))
+}
+
+// quoteValue quotes a value if it would be ambiguous in key=value form.
+func quoteValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\r\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
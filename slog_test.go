@@ -0,0 +1,141 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "fmt"
+import "log"
+import "time"
+import "runtime"
+import "bytes"
+import "strings"
+import "context"
+import "testing"
+import "log/slog"
+
+func TestSlogHandler(t *testing.T) {
+	out := &bytes.Buffer{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for l := Debug; l <= Err; l++ {
+		lc.Writer(l, out)
+	}
+	sl := slog.New(NewSlogHandler(lc.NewSessionLoggerWithID("slog", "abc")))
+
+	sl.Debug("d")
+	sl.Info("hello", "user", "bob", "n", 3)
+	sl.Warn("careful", "msg", "two words")
+	sl.Error("bad", slog.Group("req", "id", 7))
+	sl.With("a", 1).WithGroup("g").Info("nested", "b", 2)
+
+	want := []string{
+		"INFO@slog:abc: d",
+		"INFO@slog:abc: hello user=bob n=3",
+		`WARN@slog:abc: careful msg="two words"`,
+		" ERR@slog:abc: bad req.id=7",
+		"INFO@slog:abc: nested a=1 g.b=2",
+	}
+	got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSlogHandlerEnabled(t *testing.T) {
+	h := (&Config{}).Writer(Info, &bytes.Buffer{}).SetMinLevel(Info).NewSlogHandler()
+
+	if !slog.New(h).Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug is not enabled, but it goes to the info level")
+	}
+	sl := slog.New(h.WithDebugLevel())
+	if sl.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("debug is enabled, but the level is disabled in the config")
+	}
+	if !sl.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info is not enabled")
+	}
+}
+
+func TestSlogHandlerDebugLevel(t *testing.T) {
+	out := &bytes.Buffer{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Debug, out).Writer(Info, out)
+	sl := slog.New(lc.NewSlogHandler().WithDebugLevel()).With("a", 1)
+
+	sl.Debug("d")
+	sl.Info("i")
+	if got := out.String(); got != "DBUG: d a=1\nINFO: i a=1\n" {
+		t.Errorf("output %q", got)
+	}
+}
+
+func TestSlogHandlerCaller(t *testing.T) {
+	out := &bytes.Buffer{}
+	h := (&Config{}).Writer(Info, out).Flags(log.Lshortfile).NewSlogHandler()
+
+	slog.New(h).Info("where")
+	if !strings.Contains(out.String(), "slog_test.go:") {
+		t.Errorf("caller is not the test: %q", out.String())
+	}
+}
+
+func TestSlogHandlerRecordPC(t *testing.T) {
+	out := &bytes.Buffer{}
+	h := (&Config{}).Writer(Info, out).Flags(log.Lshortfile).LogSessionStart(false).NewSlogHandler()
+
+	// A record made by hand, as by an adapter from another logging API, with the PC of this line.
+	pcs := [1]uintptr{}
+	runtime.Callers(1, pcs[:])
+	want := line() - 1
+	h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "by hand", pcs[0]))
+
+	if got := out.String(); got != fmt.Sprintf("INFO: slog_test.go:%d: by hand\n", want) {
+		t.Errorf("output %q, want the line %d", got, want)
+	}
+
+	// Without a PC the file is unknown, as with the log package.
+	out.Reset()
+	h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "nowhere", 0))
+	if got := out.String(); got != "INFO: ???:0: nowhere\n" {
+		t.Errorf("output %q", got)
+	}
+}
+
+func TestSlogHandlerLmsgprefix(t *testing.T) {
+	out := &bytes.Buffer{}
+	h := (&Config{}).Writer(Warn, out).Flags(log.Lshortfile | log.Lmsgprefix).LogSessionStart(false).NewSlogHandler()
+
+	slog.New(h).Warn("after the file")
+	if got := out.String(); !strings.HasPrefix(got, "slog_test.go:") || !strings.HasSuffix(got, ": WARN: after the file\n") {
+		t.Errorf("output %q", got)
+	}
+}
+
+func TestSlogHandlerClock(t *testing.T) {
+	clock := func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC) }
+	out := &bytes.Buffer{}
+	h := (&Config{Clock: clock}).Writer(Info, out).Flags(log.Ltime).LogSessionStart(false).PrefixEachLine(true).
+		NewSlogHandler()
+
+	slog.New(h).Info("two\nlines")
+	if got := out.String(); got != "INFO: 05:06:07 two\nINFO: lines\n" {
+		t.Errorf("output %q", got)
+	}
+}
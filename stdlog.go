@@ -0,0 +1,90 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "log"
+import "sync"
+import "bytes"
+import "runtime"
+import "strings"
+
+// RedirectStdLog makes the standard logger of the log package (the one used by log.Println and friends) write to
+// the info level of lc, so messages from code that does not know about this package end up in the same place.
+// The messages get the prefix of a master logger with the endpoint "stdlog", so they look like
+// "INFO@stdlog: ...", and the flags of the config. They are written the same way as messages from the methods of
+// Logger, so Config.Clock and PrefixEachLine apply to them, and the file flags give the code that called the log
+// package.
+//
+// This changes global state, so only one config can be redirected to at a time. The returned function puts the
+// standard logger back the way it was before, and may be called more than once.
+func RedirectStdLog(lc *Config) (restore func()) {
+	l := lc.NewMasterLogger().Sub("stdlog")
+
+	std := log.Default()
+	oldOut, oldPrefix, oldFlags := std.Writer(), std.Prefix(), std.Flags()
+	log.SetOutput(&stdLogWriter{l: l})
+	log.SetPrefix("")
+	log.SetFlags(0)
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			log.SetOutput(oldOut)
+			log.SetPrefix(oldPrefix)
+			log.SetFlags(oldFlags)
+		})
+	}
+}
+
+// stdLogWriter is the output of the standard logger while it is redirected. The standard logger has no prefix or
+// flags, so each write is just the message, which is passed on to the info level of l.
+type stdLogWriter struct {
+	l *Logger
+}
+
+func (sw *stdLogWriter) Write(p []byte) (int, error) {
+	if !sw.l.enabled(Info) {
+		return len(p), nil
+	}
+
+	// Find the code that called the log package (or log/slog, which writes through it by default).
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	file, line := "???", 0
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") && !strings.HasPrefix(frame.Function, "log/slog.") {
+			file, line = frame.File, frame.Line
+			break
+		}
+		if !more {
+			break
+		}
+	}
+
+	err := sw.l.outputAt(Info, file, line, string(bytes.TrimSuffix(p, []byte("\n"))))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
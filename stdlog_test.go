@@ -0,0 +1,77 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "os"
+import "log"
+import "fmt"
+import "time"
+import "bytes"
+import "testing"
+
+func TestRedirectStdLog(t *testing.T) {
+	old := &bytes.Buffer{}
+	log.SetOutput(old)
+	log.SetPrefix("old: ")
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetPrefix("")
+		log.SetFlags(log.LstdFlags)
+	})
+
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).Writer(Info, cw)
+	restore := RedirectStdLog(lc)
+	log.Println("from a library")
+	restore()
+	restore()
+	log.Println("after restore")
+
+	if want := "INFO@stdlog: from a library\n"; cw.String() != want {
+		t.Errorf("config got %q, want %q", cw.String(), want)
+	}
+	if want := "old: after restore\n"; old.String() != want {
+		t.Errorf("restored logger got %q, want %q", old.String(), want)
+	}
+}
+
+func TestRedirectStdLogClock(t *testing.T) {
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetPrefix("")
+		log.SetFlags(log.LstdFlags)
+	})
+
+	clock := func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC) }
+	cw := &CaptureWriter{}
+	lc := (&Config{Clock: clock}).Flags(log.Ldate|log.Ltime|log.Lshortfile).Writer(Info, cw).PrefixEachLine(true)
+	restore := RedirectStdLog(lc)
+	defer restore()
+
+	log.Print("two\nlines")
+	want := fmt.Sprintf("INFO@stdlog: 2022/03/04 05:06:07 stdlog_test.go:%d: two\nINFO@stdlog: lines\n", line()-1)
+	if cw.String() != want {
+		t.Errorf("got %q, want %q", cw.String(), want)
+	}
+}
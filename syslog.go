@@ -0,0 +1,68 @@
+//go:build !windows && !plan9
+
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "log/syslog"
+
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+// SyslogWriter connects to a syslog daemon (see syslog.Dial for the meaning of the arguments) and returns a writer
+// that sends each message with a priority matching its log level. The level is detected from the level token at
+// the start of the message, so use the same writer for any or all levels.
+//
+// Syslog is not available on Windows or Plan 9, there this always returns an error.
+func SyslogWriter(network, raddr, tag string) (io.Writer, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w}, nil
+}
+
+func (sw *syslogWriter) Write(p []byte) (int, error) {
+	var err error
+	msg := string(p)
+	switch lineLevel(p) {
+	case Debug:
+		err = sw.w.Debug(msg)
+	case Warn:
+		err = sw.w.Warning(msg)
+	case Err:
+		err = sw.w.Err(msg)
+	default:
+		err = sw.w.Info(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (sw *syslogWriter) Close() error {
+	return sw.w.Close()
+}
@@ -0,0 +1,81 @@
+//go:build !windows && !plan9
+
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "net"
+import "time"
+import "strings"
+import "testing"
+
+func TestSyslogWriter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen for syslog packets: %v", err)
+	}
+	defer conn.Close()
+
+	sw, err := SyslogWriter("udp", conn.LocalAddr().String(), "sltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sw.(*syslogWriter).Close()
+
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, sw)
+	}
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	// LOG_USER is facility 1, so the priority is 8 plus the severity.
+	cases := []struct {
+		log  func(v ...any)
+		msg  string
+		prio string
+	}{
+		{l.Debug, "DBUG@ep:abc: low", "<15>"},
+		{l.Info, "INFO@ep:abc: normal", "<14>"},
+		{l.Warn, "WARN@ep:abc: odd", "<12>"},
+		{l.Err, " ERR@ep:abc: bad", "<11>"},
+	}
+
+	buf := make([]byte, 2048)
+	for _, c := range cases {
+		_, text, _ := strings.Cut(c.msg, ": ")
+		c.log(text)
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("reading packet for %q: %v", c.msg, err)
+		}
+		pkt := string(buf[:n])
+		if !strings.HasPrefix(pkt, c.prio) {
+			t.Errorf("packet %q does not have priority %s", pkt, c.prio)
+		}
+		if !strings.Contains(pkt, " sltest[") || !strings.HasSuffix(pkt, c.msg+"\n") {
+			t.Errorf("packet %q does not end with %q", pkt, c.msg)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "fmt"
+import "log"
+import "bytes"
+import "errors"
+import "reflect"
+import "unicode/utf8"
+import "sync/atomic"
+
+// selfLog is used to report problems with the logging system itself, such as writers failing in the background.
+var selfLog = log.New(os.Stderr, levelTokens[Err]+": ", log.Ldate|log.Ltime)
+
+// multiWriter works exactly like the writer returned by io.MultiWriter, but it keeps the list of writers
+// accessible so that Close and friends can find the files hiding inside.
+type multiWriter struct {
+	writers []io.Writer
+}
+
+func newMultiWriter(w ...io.Writer) *multiWriter {
+	all := make([]io.Writer, 0, len(w))
+	for _, w := range w {
+		if mw, ok := w.(*multiWriter); ok {
+			all = append(all, mw.writers...)
+		} else {
+			all = append(all, w)
+		}
+	}
+	return &multiWriter{all}
+}
+
+// combineWriters returns the only writer if there is just one, otherwise the writers combined into a multiWriter.
+func combineWriters(w ...io.Writer) io.Writer {
+	if len(w) == 1 {
+		return w[0]
+	}
+	return newMultiWriter(w...)
+}
+
+func (mw *multiWriter) Write(p []byte) (n int, err error) {
+	for _, w := range mw.writers {
+		n, err = w.Write(p)
+		if err != nil {
+			return
+		}
+		if n != len(p) {
+			err = io.ErrShortWrite
+			return
+		}
+	}
+	return len(p), nil
+}
+
+func (mw *multiWriter) unwrap() []io.Writer {
+	return mw.writers
+}
+
+// resilientWriter is a multiWriter that keeps going when a writer fails.
+type resilientWriter struct {
+	writers []io.Writer
+	onErr   func(error)
+}
+
+// ResilientMultiWriter combines writers like io.MultiWriter, except that a write is attempted on every writer
+// even if some of them fail, so one broken destination (a full disk, a closed connection) does not stop the
+// messages from reaching the rest. Use it in place of io.MultiWriter (or several writers passed to
+// Config.Writer) when that matters.
+//
+// Each error is passed to onErr (if not nil) as it happens. The log package ignores errors, so this is the
+// only way to find out about them when used as the destination of a logger. Write always reports the whole of
+// p as written, along with all the errors joined together.
+func ResilientMultiWriter(onErr func(error), w ...io.Writer) io.Writer {
+	return &resilientWriter{writers: append([]io.Writer{}, w...), onErr: onErr}
+}
+
+func (rw *resilientWriter) Write(p []byte) (int, error) {
+	errs := []error{}
+	for _, w := range rw.writers {
+		n, err := w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if rw.onErr != nil {
+				rw.onErr(err)
+			}
+		}
+	}
+	return len(p), errors.Join(errs...)
+}
+
+func (rw *resilientWriter) unwrap() []io.Writer {
+	return rw.writers
+}
+
+// countingWriter counts the writes made to it, and the ones that failed. The log package makes exactly one write
+// per message, so this counts messages.
+type countingWriter struct {
+	w    io.Writer
+	n    *atomic.Uint64
+	errs *atomic.Uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n.Add(1)
+	n, err := cw.w.Write(p)
+	if err != nil {
+		cw.errs.Add(1)
+	}
+	return n, err
+}
+
+func (cw *countingWriter) unwrap() []io.Writer {
+	return []io.Writer{cw.w}
+}
+
+// levelTokens are the strings that start each message, identifying its level.
+var levelTokens = [4]string{
+	"DBUG",
+	"INFO",
+	"WARN",
+	" ERR",
+}
+
+// lineLevel guesses the level of a message from the level token at the start of it (or the level field, for
+// JSON output and LogfmtFormatter). Messages that do not start with a known token are assumed to be info.
+func lineLevel(p []byte) logLevel {
+	p = p[seqLen(p):]
+	for l, tok := range levelTokens {
+		if len(p) >= len(tok) && string(p[:len(tok)]) == tok {
+			return logLevel(l)
+		}
+	}
+
+	const jsonLead = `{"level":"`
+	if bytes.HasPrefix(p, []byte(jsonLead)) {
+		if l, ok := levelName(p[len(jsonLead):], '"'); ok {
+			return l
+		}
+	}
+
+	// LogfmtFormatter starts with the time, which has no spaces, and the level follows it.
+	const logfmtLead, logfmtLevel = "time=", " level="
+	if bytes.HasPrefix(p, []byte(logfmtLead)) {
+		rest := p[len(logfmtLead):]
+		if i := bytes.IndexByte(rest, ' '); i >= 0 && bytes.HasPrefix(rest[i:], []byte(logfmtLevel)) {
+			if l, ok := levelName(rest[i+len(logfmtLevel):], ' '); ok {
+				return l
+			}
+		}
+	}
+	return Info
+}
+
+// levelName finds the level whose name (as from logLevel.String) starts p, followed by end.
+func levelName(p []byte, end byte) (logLevel, bool) {
+	for l := Debug; l <= Err; l++ {
+		name := l.String()
+		if len(p) > len(name) && string(p[:len(name)]) == name && p[len(name)] == end {
+			return l, true
+		}
+	}
+	return Info, false
+}
+
+// seqWriter starts each write with the next sequence number.
+type seqWriter struct {
+	w io.Writer
+	n *atomic.Uint64
+}
+
+func (sw *seqWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p)+10)
+	buf = fmt.Appendf(buf, "#%06d ", sw.n.Add(1))
+	buf = append(buf, p...)
+
+	_, err := sw.w.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (sw *seqWriter) unwrap() []io.Writer {
+	return []io.Writer{sw.w}
+}
+
+// seqLen returns the length of the sequence number at the start of p, including the space after it, or 0 if
+// there is none.
+func seqLen(p []byte) int {
+	if len(p) == 0 || p[0] != '#' {
+		return 0
+	}
+	return bytes.IndexByte(p, ' ') + 1
+}
+
+// sanitizeWriter escapes control characters and invalid UTF-8 in each write, see Config.SanitizeControlChars.
+type sanitizeWriter struct {
+	w io.Writer
+}
+
+func (sw *sanitizeWriter) Write(p []byte) (int, error) {
+	_, err := sw.w.Write(sanitizeLine(p))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (sw *sanitizeWriter) unwrap() []io.Writer {
+	return []io.Writer{sw.w}
+}
+
+// sanitizeLine returns p with everything that needs escaping escaped, or p itself if nothing does. A line ending
+// at the end of p is kept.
+func sanitizeLine(p []byte) []byte {
+	body := bytes.TrimSuffix(p, []byte("\n"))
+	i := 0
+	for i < len(body) {
+		r, size := utf8.DecodeRune(body[i:])
+		if needsEscape(r, size) {
+			break
+		}
+		i += size
+	}
+	if i == len(body) {
+		return p
+	}
+
+	const hex = "0123456789abcdef"
+	buf := make([]byte, 0, len(p)+16)
+	buf = append(buf, body[:i]...)
+	for i < len(body) {
+		r, size := utf8.DecodeRune(body[i:])
+		switch {
+		case !needsEscape(r, size):
+			buf = append(buf, body[i:i+size]...)
+		case r == '\n':
+			buf = append(buf, `\n`...)
+		case r == '\r':
+			buf = append(buf, `\r`...)
+		case size == 1:
+			// ASCII controls and bytes that are not valid UTF-8.
+			buf = append(buf, '\\', 'x', hex[body[i]>>4], hex[body[i]&0xf])
+		default:
+			// C1 controls.
+			buf = append(buf, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+		}
+		i += size
+	}
+	if len(body) < len(p) {
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// needsEscape reports if a rune decoded from a message must be escaped by sanitizeLine.
+func needsEscape(r rune, size int) bool {
+	switch {
+	case r == utf8.RuneError && size == 1:
+		return true
+	case r == '\t':
+		return false
+	case r < 0x20, r == 0x7f:
+		return true
+	case r >= 0x80 && r <= 0x9f:
+		return true
+	}
+	return false
+}
+
+// truncateMarker is added to messages cut short by a truncateWriter.
+const truncateMarker = "…(truncated)"
+
+// truncateWriter cuts each write down to at most max bytes, not counting the marker and line ending.
+type truncateWriter struct {
+	w   io.Writer
+	max int
+}
+
+func (tw *truncateWriter) Write(p []byte) (int, error) {
+	msg := bytes.TrimSuffix(p, []byte("\n"))
+	if len(msg) <= tw.max {
+		return tw.w.Write(p)
+	}
+
+	cut := tw.max
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+
+	buf := make([]byte, 0, cut+len(truncateMarker)+1)
+	buf = append(buf, msg[:cut]...)
+	buf = append(buf, truncateMarker...)
+	if len(msg) < len(p) {
+		buf = append(buf, '\n')
+	}
+
+	_, err := tw.w.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (tw *truncateWriter) unwrap() []io.Writer {
+	return []io.Writer{tw.w}
+}
+
+// unwrapper is implemented by writers in this package that wrap other writers.
+type unwrapper interface {
+	unwrap() []io.Writer
+}
+
+// walkWriters calls fn for w and every writer wrapped by it, recursively.
+func walkWriters(w io.Writer, fn func(w io.Writer)) {
+	if w == nil {
+		return
+	}
+	fn(w)
+	if uw, ok := w.(unwrapper); ok {
+		for _, w := range uw.unwrap() {
+			walkWriters(w, fn)
+		}
+	}
+}
+
+// flatWriters returns every writer found by walking the given writers, without duplicates, parents before the
+// writers they wrap.
+func flatWriters(writers ...io.Writer) []io.Writer {
+	all := []io.Writer{}
+	for _, w := range writers {
+		walkWriters(w, func(w io.Writer) {
+			if reflect.TypeOf(w).Comparable() {
+				for _, s := range all {
+					if s == w {
+						return
+					}
+				}
+			}
+			all = append(all, w)
+		})
+	}
+	return all
+}
+
+// closeWriters closes every io.Closer found in the given writers, skipping duplicates and the standard
+// streams. The first error is returned, but closing continues past it.
+func closeWriters(writers ...io.Writer) error {
+	var first error
+	for _, w := range flatWriters(writers...) {
+		c, ok := w.(io.Closer)
+		if !ok || w == os.Stdout || w == os.Stderr {
+			continue
+		}
+
+		err := c.Close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// syncWriters syncs (or flushes) every writer found in the given writers that supports it, skipping duplicates
+// and the standard streams. All the errors are returned joined together.
+func syncWriters(writers ...io.Writer) error {
+	errs := []error{}
+	for _, w := range flatWriters(writers...) {
+		if w == os.Stdout || w == os.Stderr {
+			continue
+		}
+
+		var err error
+		switch w := w.(type) {
+		case interface{ Sync() error }:
+			err = w.Sync()
+		case interface{ Flush() error }:
+			err = w.Flush()
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2022 by Milo Christiansen
+
+This software is provided 'as-is', without any express or implied warranty. In
+no event will the authors be held liable for any damages arising from the use of
+this software.
+
+Permission is granted to anyone to use this software for any purpose, including
+commercial applications, and to alter it and redistribute it freely, subject to
+the following restrictions:
+
+1. The origin of this software must not be misrepresented; you must not claim
+that you wrote the original software. If you use this software in a product, an
+acknowledgment in the product documentation would be appreciated but is not
+required.
+
+2. Altered source versions must be plainly marked as such, and must not be
+misrepresented as being the original software.
+
+3. This notice may not be removed or altered from any source distribution.
+*/
+
+package sessionlogger
+
+import "io"
+import "os"
+import "fmt"
+import "sync"
+import "bytes"
+import "errors"
+import "strings"
+import "testing"
+import "unicode/utf8"
+import "path/filepath"
+
+// brokenWriter fails every write with err after writing n bytes.
+type brokenWriter struct {
+	n   int
+	err error
+}
+
+func (bw brokenWriter) Write(p []byte) (int, error) {
+	return min(bw.n, len(p)), bw.err
+}
+
+func TestResilientMultiWriter(t *testing.T) {
+	errFull := errors.New("disk full")
+	first, last := &bytes.Buffer{}, &bytes.Buffer{}
+
+	seen := []error{}
+	w := ResilientMultiWriter(func(err error) { seen = append(seen, err) },
+		first, brokenWriter{err: errFull}, brokenWriter{n: 2}, last)
+
+	n, err := w.Write([]byte("hello\n"))
+	if n != 6 {
+		t.Errorf("Write reported %d bytes", n)
+	}
+	if !errors.Is(err, errFull) || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("Write returned %v, want both errors", err)
+	}
+	if len(seen) != 2 || seen[0] != errFull || seen[1] != io.ErrShortWrite {
+		t.Errorf("onErr got %v", seen)
+	}
+	if first.String() != "hello\n" || last.String() != "hello\n" {
+		t.Errorf("working writers got %q and %q", first.String(), last.String())
+	}
+
+	// Compare with io.MultiWriter, which stops at the first failure.
+	last.Reset()
+	io.MultiWriter(brokenWriter{err: errFull}, last).Write([]byte("hello\n"))
+	if last.Len() != 0 {
+		t.Errorf("io.MultiWriter no longer stops on errors, update the docs")
+	}
+}
+
+func TestResilientMultiWriterInLogger(t *testing.T) {
+	good := &bytes.Buffer{}
+	lc := (&Config{}).Writer(Warn, ResilientMultiWriter(nil, brokenWriter{err: io.ErrClosedPipe}, good)).
+		Flags(NoFlags).LogSessionStart(false)
+
+	lc.NewMasterLogger().Warn("still here")
+	if good.String() != "WARN: still here\n" {
+		t.Errorf("output %q", good.String())
+	}
+	if st := lc.Stats(); st.WriteErrors != 1 {
+		t.Errorf("Stats().WriteErrors = %v", st.WriteErrors)
+	}
+}
+
+func TestTruncateWriter(t *testing.T) {
+	cases := []struct {
+		max      int
+		in, want string
+	}{
+		{10, "short\n", "short\n"},
+		{5, "exact\n", "exact\n"},
+		{5, "longer\n", "longe…(truncated)\n"},
+		{5, "no newline", "no ne…(truncated)"},
+		{4, "ab€cd\n", "ab…(truncated)\n"}, // € is 3 bytes, cutting at 4 would split it.
+		{5, "ab€cd\n", "ab€…(truncated)\n"},
+		{2, "ééé\n", "é…(truncated)\n"},
+		{1, "ééé\n", "…(truncated)\n"},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		tw := &truncateWriter{w: buf, max: c.max}
+		n, err := tw.Write([]byte(c.in))
+		if n != len(c.in) || err != nil {
+			t.Errorf("Write(%q) returned %v, %v", c.in, n, err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("max %d: %q became %q, want %q", c.max, c.in, buf.String(), c.want)
+		}
+	}
+}
+
+func TestMaxLineBytes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := (&Config{}).Writer(Info, buf).Flags(NoFlags).LogSessionStart(false).MaxLineBytes(1024).NewMasterLogger()
+
+	l.Info(strings.Repeat("ø", 1<<20))
+	out := buf.String()
+	if !strings.HasPrefix(out, "INFO: øø") || !strings.HasSuffix(out, "ø…(truncated)\n") {
+		t.Errorf("output starts %.20q and ends %q", out, out[len(out)-20:])
+	}
+	if n := len(out) - len("…(truncated)\n"); n > 1024 || n < 1023 {
+		t.Errorf("kept %d bytes of the message, want 1023 or 1024", n)
+	}
+	if !utf8.ValidString(out) {
+		t.Errorf("output is not valid UTF-8")
+	}
+}
+
+// Run with -race.
+func TestSequencedConcurrent(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Sequenced(true).Flags(NoFlags).LogSessionStart(false)
+	for _, lvl := range []logLevel{Debug, Info, Warn, Err} {
+		lc.Writer(lvl, cw)
+	}
+
+	const goroutines, each = 16, 50
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := lc.NewSessionLogger("seq")
+			for j := 0; j < each; j++ {
+				switch j % 4 {
+				case 0:
+					l.Debug("d")
+				case 1:
+					l.Info("i")
+				case 2:
+					l.Warn("w")
+				case 3:
+					l.Err("e")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for _, line := range cw.Lines() {
+		var n int
+		if _, err := fmt.Sscanf(line, "#%06d ", &n); err != nil || len(line) < 8 || line[7] != ' ' {
+			t.Fatalf("line %q does not start with a sequence number", line)
+		}
+		if seen[n] {
+			t.Errorf("sequence number %d used twice", n)
+		}
+		seen[n] = true
+	}
+	for n := 1; n <= goroutines*each; n++ {
+		if !seen[n] {
+			t.Errorf("sequence number %d is missing", n)
+		}
+	}
+	if len(seen) != goroutines*each {
+		t.Errorf("%d sequence numbers, want %d", len(seen), goroutines*each)
+	}
+}
+
+func TestSingleWriterStoredDirectly(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "direct.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	a, b := &bytes.Buffer{}, &bytes.Buffer{}
+	lc := (&Config{}).Writer(Info, a).SetWriter(Warn, f).Writer(Err, a, b).Flags(NoFlags)
+
+	if lc.Writers[Info] != io.Writer(a) {
+		t.Errorf("single writer wrapped in %T", lc.Writers[Info])
+	}
+	if got, ok := lc.Writers[Warn].(*os.File); !ok || got != f {
+		t.Errorf("SetWriter stored %T", lc.Writers[Warn])
+	}
+
+	lc.NewMasterLogger().Err("both")
+	if a.String() != " ERR: both\n" || b.String() != " ERR: both\n" {
+		t.Errorf("multiple writers got %q and %q", a.String(), b.String())
+	}
+}
+
+func TestSanitizeControlChars(t *testing.T) {
+	cw := &CaptureWriter{}
+	lc := (&Config{}).Flags(NoFlags).LogSessionStart(false).Writer(Info, cw).SanitizeControlChars(true)
+	l := lc.NewSessionLoggerWithID("ep", "abc")
+
+	cases := []struct{ in, want string }{
+		{"plain text", "plain text"},
+		{"tab\tkept, ünïcødé ✓ kept", "tab\tkept, ünïcødé ✓ kept"},
+		{"\x1b[31mred\x1b[0m", `\x1b[31mred\x1b[0m`},
+		{"forged\n ERR@ep:abc: line", `forged\n ERR@ep:abc: line`},
+		{"cr\r bell\a del\x7f nul\x00", `cr\r bell\x07 del\x7f nul\x00`},
+		{"c1 \u009b csi", `c1 \u009b csi`},
+		{"bad \xff\xfe utf8 \xe2\x82", `bad \xff\xfe utf8 \xe2\x82`},
+	}
+	for _, c := range cases {
+		cw.Reset()
+		l.Info(c.in)
+		if want := "INFO@ep:abc: " + c.want + "\n"; cw.String() != want {
+			t.Errorf("%q was written as %q, want %q", c.in, cw.String(), want)
+		}
+	}
+}
+
+func FuzzSanitizeLine(f *testing.F) {
+	for _, s := range []string{"plain\n", "\x1b[2J\n", "a\nb", "\xc2\x9b\xff", "é\t✓\r\n", ""} {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		out := sanitizeLine(in)
+
+		if !utf8.Valid(out) {
+			t.Fatalf("%q became invalid UTF-8 %q", in, out)
+		}
+		body := bytes.TrimSuffix(out, []byte("\n"))
+		if len(body) < len(out) != bytes.HasSuffix(in, []byte("\n")) {
+			t.Fatalf("line ending of %q not kept in %q", in, out)
+		}
+		for _, r := range string(body) {
+			if (r < 0x20 && r != '\t') || (r >= 0x7f && r <= 0x9f) {
+				t.Fatalf("%q left %U in %q", in, r, out)
+			}
+		}
+
+		// Input that is already safe is left alone.
+		safe := utf8.Valid(in)
+		for _, r := range string(bytes.TrimSuffix(in, []byte("\n"))) {
+			if (r < 0x20 && r != '\t') || (r >= 0x7f && r <= 0x9f) {
+				safe = false
+			}
+		}
+		if safe && !bytes.Equal(in, out) {
+			t.Fatalf("safe input %q changed to %q", in, out)
+		}
+	})
+}